@@ -71,7 +71,9 @@ func checkForTables() {
 				home_team INT REFERENCES teams(team_id) ON DELETE CASCADE,
 				away_team INT REFERENCES teams(team_id) ON DELETE CASCADE,
 				home_score INT DEFAULT 0,
-				away_score INT DEFAULT 0
+				away_score INT DEFAULT 0,
+				status TEXT NOT NULL DEFAULT 'scheduled'
+					CHECK (status IN ('scheduled', 'live', 'paused', 'final', 'synced', 'cancelled'))
 			);
 		`)
 
@@ -88,10 +90,75 @@ func checkForTables() {
 				team_id INT REFERENCES teams(team_id) ON DELETE CASCADE,
 				player_id INT REFERENCES players(player_id) ON DELETE CASCADE,
 				minute REAL,
+				period INT,
 				stat TEXT NOT NULL,
-				match_date DATE NOT NULL
+				match_date DATE NOT NULL,
+				event_id TEXT,  -- live event id, unique within the match
+				linked_player_id INT REFERENCES players(player_id) ON DELETE SET NULL,  -- other side of a play, e.g. the assisted scorer
+				linked_event_id TEXT
 			);
 		`)
+
+	createTableIfNotExists("matches_rosters", `
+			CREATE TABLE matches_rosters (
+				match_id INT REFERENCES matches(match_id) ON DELETE CASCADE,
+				team_id INT REFERENCES teams(team_id) ON DELETE CASCADE,
+				player_id INT REFERENCES players(player_id) ON DELETE CASCADE,
+				starter BOOLEAN NOT NULL DEFAULT FALSE,
+				PRIMARY KEY (match_id, player_id)
+			);
+		`)
+
+	createTableIfNotExists("matches_team_fouls", `
+			CREATE TABLE matches_team_fouls (
+				match_id INT REFERENCES matches(match_id) ON DELETE CASCADE,
+				team_id INT REFERENCES teams(team_id) ON DELETE CASCADE,
+				period INT NOT NULL,
+				fouls INT NOT NULL DEFAULT 0,
+				penalty_reached BOOLEAN NOT NULL DEFAULT FALSE,  -- team reached the penalty in this period
+				PRIMARY KEY (match_id, team_id, period)
+			);
+		`)
+
+	// Periods were added after matches_stats was first deployed.
+	// Backfill them from the elapsed minute: 12 minute quarters, then 5 minute overtimes.
+	if _, err := PG.Exec(`
+		ALTER TABLE matches_stats ADD COLUMN IF NOT EXISTS period INT;
+		UPDATE matches_stats
+		SET period = CASE
+			WHEN minute <= 48 THEN GREATEST(1, CEIL(minute / 12))
+			ELSE 4 + CEIL((minute - 48) / 5)
+		END
+		WHERE period IS NULL AND minute IS NOT NULL;
+	`); err != nil {
+		log.Fatalf("Error migrating matches_stats periods: %v", err)
+	}
+
+	// Rebounds synced before the offensive/defensive split have no known type (handlers.unknownReboundStat)
+	if _, err := PG.Exec(`
+		UPDATE matches_stats SET stat = 'unknown_rebounds' WHERE stat = 'rebounds';
+	`); err != nil {
+		log.Fatalf("Error migrating matches_stats rebounds: %v", err)
+	}
+
+	if _, err := PG.Exec(`
+		ALTER TABLE matches_stats ADD COLUMN IF NOT EXISTS event_id TEXT;
+		ALTER TABLE matches_stats ADD COLUMN IF NOT EXISTS linked_player_id INT REFERENCES players(player_id) ON DELETE SET NULL;
+		ALTER TABLE matches_stats ADD COLUMN IF NOT EXISTS linked_event_id TEXT;
+	`); err != nil {
+		log.Fatalf("Error migrating matches_stats linked plays: %v", err)
+	}
+
+	// Match status was added after matches was first deployed.
+	// Matches that already have synced stats were played to the end.
+	if _, err := PG.Exec(`
+		ALTER TABLE matches ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'scheduled'
+			CHECK (status IN ('scheduled', 'live', 'paused', 'final', 'synced', 'cancelled'));
+		UPDATE matches m SET status = 'synced'
+		WHERE status = 'scheduled' AND EXISTS (SELECT 1 FROM matches_stats ms WHERE ms.match_id = m.match_id);
+	`); err != nil {
+		log.Fatalf("Error migrating matches status: %v", err)
+	}
 }
 
 func createTableIfNotExists(tableName, createSQL string) {
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// boxScoreLine is a player's line in a box score, or a team's totals
+type boxScoreLine struct {
+	PlayerID          int    `json:"playerId,omitempty"`
+	PlayerName        string `json:"playerName,omitempty"`
+	Minutes           string `json:"minutes"`
+	Points            int    `json:"points"`
+	Rebounds          int    `json:"rebounds"`
+	OffensiveRebounds int    `json:"offensive_rebounds"`
+	DefensiveRebounds int    `json:"defensive_rebounds"`
+	Assists           int    `json:"assists"`
+	Steals            int    `json:"steals"`
+	Blocks            int    `json:"blocks"`
+	Turnovers         int    `json:"turnovers"`
+	Fouls             int    `json:"fouls"` // personal fouls, flagrants included
+	TechnicalFouls    int    `json:"technical_fouls"`
+	FGM               int    `json:"fgm"`
+	FGA               int    `json:"fga"`
+	ThreePM           int    `json:"3pm"`
+	ThreePA           int    `json:"3pa"`
+	FTM               int    `json:"ftm"`
+	FTA               int    `json:"fta"`
+	PlusMinus         int    `json:"plusMinus"`
+
+	seconds int
+}
+
+// add counts one record into the line
+func (l *boxScoreLine) add(stat string) {
+	l.Points += pointValues[stat]
+	switch stat {
+	case "offensive_rebounds":
+		l.OffensiveRebounds++
+	case "defensive_rebounds":
+		l.DefensiveRebounds++
+	case "assists":
+		l.Assists++
+	case "steals":
+		l.Steals++
+	case "blocks":
+		l.Blocks++
+	case "turnovers":
+		l.Turnovers++
+	case "technical_fouls":
+		l.TechnicalFouls++
+	case "1pt":
+		l.FTM++
+		l.FTA++
+	case "1pt_miss":
+		l.FTA++
+	case "2pt":
+		l.FGM++
+		l.FGA++
+	case "2pt_miss":
+		l.FGA++
+	case "3pt":
+		l.FGM++
+		l.FGA++
+		l.ThreePM++
+		l.ThreePA++
+	case "3pt_miss":
+		l.FGA++
+		l.ThreePA++
+	}
+	if slices.Contains(reboundStats, stat) {
+		l.Rebounds++
+	}
+	if slices.Contains(personalFoulStats, stat) {
+		l.Fouls++
+	}
+}
+
+func (l *boxScoreLine) addLine(other boxScoreLine) {
+	l.seconds += other.seconds
+	l.Points += other.Points
+	l.Rebounds += other.Rebounds
+	l.OffensiveRebounds += other.OffensiveRebounds
+	l.DefensiveRebounds += other.DefensiveRebounds
+	l.Assists += other.Assists
+	l.Steals += other.Steals
+	l.Blocks += other.Blocks
+	l.Turnovers += other.Turnovers
+	l.Fouls += other.Fouls
+	l.TechnicalFouls += other.TechnicalFouls
+	l.FGM += other.FGM
+	l.FGA += other.FGA
+	l.ThreePM += other.ThreePM
+	l.ThreePA += other.ThreePA
+	l.FTM += other.FTM
+	l.FTA += other.FTA
+}
+
+type boxScoreTeam struct {
+	TeamID    int            `json:"teamId"`
+	TeamName  string         `json:"teamName"`
+	Score     int            `json:"score"`
+	LineScore []int          `json:"lineScore"` // points per period, in period order
+	Players   []boxScoreLine `json:"players"`
+	Totals    boxScoreLine   `json:"totals"`
+	Tempo     teamTempo      `json:"tempo"`
+}
+
+// GetBoxScore returns both teams of a match with every player's line, team totals, tempo and
+// the line score, from the live match or from 'matches_stats' once it was synced
+func GetBoxScore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+
+	homeTeamID, awayTeamID, err := matchHomeAway(matchID)
+	if err != nil {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+
+	records, live, err := loadMatchRecords(matchID)
+	if err != nil {
+		log.Printf("Failed to load events of match %d: %v", matchID, err)
+		http.Error(w, "Failed to load match events", http.StatusInternalServerError)
+		return
+	}
+
+	// every registered player gets a line, even without a minute played
+	rosters, err := boxScoreRosters(matchID, live)
+	if err != nil {
+		log.Printf("Failed to read roster of match %d: %v", matchID, err)
+	}
+
+	lastPeriod := 1
+	lastSecond := 0
+	for _, record := range records {
+		lastPeriod = max(lastPeriod, record.Period)
+		lastSecond = max(lastSecond, minuteToSeconds(record.Minute))
+	}
+
+	lines := make(map[int]*boxScoreLine)
+	playerTeams := make(map[int]int)
+	for teamID, playerIDs := range rosters {
+		for _, playerID := range playerIDs {
+			lines[playerID] = &boxScoreLine{PlayerID: playerID}
+			playerTeams[playerID] = teamID
+		}
+	}
+
+	teams := map[int]*boxScoreTeam{
+		homeTeamID: {TeamID: homeTeamID, LineScore: make([]int, lastPeriod), Players: []boxScoreLine{}},
+		awayTeamID: {TeamID: awayTeamID, LineScore: make([]int, lastPeriod), Players: []boxScoreLine{}},
+	}
+
+	inSince := make(map[int]int)
+	for _, record := range records {
+		team, ok := teams[record.TeamID]
+		if !ok {
+			continue
+		}
+		team.LineScore[record.Period-1] += pointValues[record.Stat]
+
+		if record.PlayerID == 0 {
+			// team stats, e.g. timeouts, are not part of any line
+			continue
+		}
+
+		line, ok := lines[record.PlayerID]
+		if !ok {
+			line = &boxScoreLine{PlayerID: record.PlayerID}
+			lines[record.PlayerID] = line
+		}
+		playerTeams[record.PlayerID] = record.TeamID
+
+		switch record.Stat {
+		case "in":
+			inSince[record.PlayerID] = minuteToSeconds(record.Minute)
+		case "out":
+			if start, ok := inSince[record.PlayerID]; ok {
+				line.seconds += minuteToSeconds(record.Minute) - start
+				delete(inSince, record.PlayerID)
+			}
+		default:
+			line.add(record.Stat)
+		}
+	}
+
+	// players still on court of a live match have played until the latest event
+	for playerID, start := range inSince {
+		lines[playerID].seconds += lastSecond - start
+	}
+
+	for playerID, pm := range plusMinus(records) {
+		if line, ok := lines[playerID]; ok {
+			line.PlusMinus = pm
+		}
+	}
+
+	var playerIDs []int
+	for playerID := range lines {
+		playerIDs = append(playerIDs, playerID)
+	}
+	slices.Sort(playerIDs)
+
+	players, err := playerNames(playerIDs)
+	if err != nil {
+		log.Printf("Failed to read player names for match %d: %v", matchID, err)
+	}
+	names, err := teamNames(homeTeamID, awayTeamID)
+	if err != nil {
+		log.Printf("Failed to read team names for match %d: %v", matchID, err)
+	}
+
+	for _, playerID := range playerIDs {
+		team, ok := teams[playerTeams[playerID]]
+		if !ok {
+			continue
+		}
+		line := lines[playerID]
+		line.PlayerName = players[playerID]
+		line.Minutes = formatSeconds(line.seconds)
+		team.Players = append(team.Players, *line)
+		team.Totals.addLine(*line)
+	}
+
+	for teamID, team := range teams {
+		team.TeamName = names[teamID]
+		team.Score = team.Totals.Points
+		team.Totals.Minutes = formatSeconds(team.Totals.seconds)
+		team.Tempo.addMatch(records, teamID, live)
+		team.Tempo.finish(1)
+	}
+	teams[homeTeamID].Totals.PlusMinus = teams[homeTeamID].Score - teams[awayTeamID].Score
+	teams[awayTeamID].Totals.PlusMinus = teams[awayTeamID].Score - teams[homeTeamID].Score
+
+	var periods []string
+	for period := 1; period <= lastPeriod; period++ {
+		periods = append(periods, periodLabel(period))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"matchId":  matchID,
+		"live":     live,
+		"periods":  periods,
+		"homeTeam": teams[homeTeamID],
+		"awayTeam": teams[awayTeamID],
+	})
+}
+
+// boxScoreRosters returns the registered players of each team of a match
+func boxScoreRosters(matchID int, live bool) (map[int][]int, error) {
+	rosters := make(map[int][]int)
+
+	if live {
+		homeTeamID, awayTeamID := matchTeams(matchID)
+		for _, teamID := range []int{homeTeamID, awayTeamID} {
+			playerIDs, err := matchRosterPlayers(db.Redis, matchID, teamID)
+			if err != nil {
+				return nil, err
+			}
+			rosters[teamID] = playerIDs
+		}
+		return rosters, nil
+	}
+
+	rows, err := db.PG.Query(`
+		SELECT team_id, player_id FROM matches_rosters WHERE match_id = $1
+	`, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teamID, playerID int
+		if err := rows.Scan(&teamID, &playerID); err != nil {
+			return nil, err
+		}
+		rosters[teamID] = append(rosters[teamID], playerID)
+	}
+	return rosters, rows.Err()
+}
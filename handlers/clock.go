@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"skyhawk/db"
+	"strconv"
+)
+
+// Game clock.
+// Event minutes are the elapsed game time in "MM.SS" format counted from tip-off across all
+// periods, so events keep ordering naturally through quarters and overtimes.
+// Periods 1-4 are the 12 minute quarters, period 5 onwards are 5 minute overtimes.
+const (
+	regulationPeriods = 4
+	quarterMinutes    = 12
+	overtimeMinutes   = 5
+)
+
+func periodStartSeconds(period int) int {
+	if period <= regulationPeriods {
+		return (period - 1) * quarterMinutes * 60
+	}
+	return regulationPeriods*quarterMinutes*60 + (period-regulationPeriods-1)*overtimeMinutes*60
+}
+
+func periodEndSeconds(period int) int {
+	if period <= regulationPeriods {
+		return periodStartSeconds(period) + quarterMinutes*60
+	}
+	return periodStartSeconds(period) + overtimeMinutes*60
+}
+
+// periodForMinute derives the period of an elapsed game minute.
+// A minute right on a period boundary belongs to the period it ends.
+func periodForMinute(minute string) int {
+	seconds := minuteToSeconds(minute)
+	period := 1
+	for seconds > periodEndSeconds(period) {
+		period++
+	}
+	return period
+}
+
+// periodOfRecord returns the period stored on a live stat record, deriving it from the
+// minute for records written before periods were tracked.
+func periodOfRecord(record map[string]string) int {
+	if period, err := strconv.Atoi(record["period"]); err == nil && period >= 1 {
+		return period
+	}
+	return periodForMinute(record["minute"])
+}
+
+func isMinuteInPeriod(minute string, period int) bool {
+	seconds := minuteToSeconds(minute)
+	return period >= 1 && seconds >= periodStartSeconds(period) && seconds <= periodEndSeconds(period)
+}
+
+// periodLabel returns "Q1".."Q4" for quarters and "OT1", "OT2"... for overtimes
+func periodLabel(period int) string {
+	if period <= regulationPeriods {
+		return fmt.Sprintf("Q%d", period)
+	}
+	return fmt.Sprintf("OT%d", period-regulationPeriods)
+}
+
+// minuteToSeconds converts an "MM.SS" minute to seconds. It also accepts minutes that went
+// through the REAL column of matches_stats, where "12.30" comes back as "12.3".
+func minuteToSeconds(minute string) int {
+	val, err := strconv.ParseFloat(minute, 64)
+	if err != nil {
+		return 0
+	}
+	minutes := math.Floor(val)
+	seconds := math.Round((val - minutes) * 100)
+	return int(minutes)*60 + int(seconds)
+}
+
+func formatSeconds(totalSeconds int) string {
+	return fmt.Sprintf("%02d.%02d", totalSeconds/60, totalSeconds%60)
+}
+
+func matchPeriodKey(matchID int) string {
+	return fmt.Sprintf("match:%d:period", matchID)
+}
+
+// currentMatchPeriod returns the latest period a live match has reached
+func currentMatchPeriod(matchID int) int {
+	period, err := db.Redis.Get(db.Ctx, matchPeriodKey(matchID)).Int()
+	if err != nil || period < 1 {
+		return 1
+	}
+	return period
+}
+
+// resolveEventPeriod returns the period of a live event, taken from the explicit period when
+// given (validating the minute falls inside it) or derived from the minute otherwise.
+// The clock may only move one period past the latest one reached, so any number of
+// overtimes can be played but a mistyped minute can't jump the match ahead.
+func resolveEventPeriod(matchID int, minute string, period int) (int, error) {
+	if period == 0 {
+		period = periodForMinute(minute)
+	} else if !isMinuteInPeriod(minute, period) {
+		return 0, fmt.Errorf("minute %s is not within %s", minute, periodLabel(period))
+	}
+
+	current := currentMatchPeriod(matchID)
+	if period > current+1 {
+		return 0, fmt.Errorf("match is in %s, can't record an event in %s", periodLabel(current), periodLabel(period))
+	}
+
+	return period, nil
+}
+
+// advanceMatchPeriod moves the match clock forward once an event lands in a later period
+func advanceMatchPeriod(matchID, period int) error {
+	if period <= currentMatchPeriod(matchID) {
+		return nil
+	}
+	return db.Redis.Set(db.Ctx, matchPeriodKey(matchID), period, 0).Err()
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+)
+
+// storedStat is a live stat record as found in a player's Redis list.
+type storedStat struct {
+	RedisKey string
+	TeamID   int
+	PlayerID int
+	Raw      string
+	Record   map[string]string
+}
+
+// findStatEvent looks up a live stat record by its event id.
+func findStatEvent(rdb redis.Cmdable, matchID int, eventID string) (*storedStat, *matchStatError) {
+	redisKey, err := rdb.HGet(db.Ctx, statIndexKey(matchID), eventID).Result()
+	if err == redis.Nil {
+		return nil, &matchStatError{http.StatusNotFound, fmt.Sprintf("Event %s not found in match %d", eventID, matchID)}
+	}
+	if err != nil {
+		return nil, &matchStatError{http.StatusInternalServerError, "Failed to read event index from Redis"}
+	}
+
+	stats, err := rdb.LRange(db.Ctx, redisKey, 0, -1).Result()
+	if err != nil {
+		return nil, &matchStatError{http.StatusInternalServerError, "Failed to read player stats from Redis"}
+	}
+
+	// match:{matchId}:team:{teamId}:player:{playerId}:stats, or match:{matchId}:team:{teamId}:stats
+	// for a team stat, which leaves playerID at 0
+	parts := strings.Split(redisKey, ":")
+	teamID, _ := strconv.Atoi(parts[3])
+	var playerID int
+	if len(parts) == 7 {
+		playerID, _ = strconv.Atoi(parts[5])
+	}
+
+	for _, raw := range stats {
+		var record map[string]string
+		if err := json.Unmarshal([]byte(raw), &record); err != nil {
+			continue
+		}
+		if record["id"] == eventID {
+			return &storedStat{RedisKey: redisKey, TeamID: teamID, PlayerID: playerID, Raw: raw, Record: record}, nil
+		}
+	}
+
+	return nil, &matchStatError{http.StatusNotFound, fmt.Sprintf("Event %s not found in match %d", eventID, matchID)}
+}
+
+// validateStatSequence replays a player's full stat list in minute order and checks it is
+// a sequence AddMatchStat would have accepted: alternating in/out starting with "in",
+// no stats while out of play, and nothing but "out" once fouled out or ejected.
+func validateStatSequence(stats []string) error {
+	stats = sortStatsByMinute(slices.Clone(stats))
+
+	var lastAction string
+	var played []string
+
+	for _, item := range stats {
+		var record map[string]string
+		if err := json.Unmarshal([]byte(item), &record); err != nil {
+			continue
+		}
+
+		stat := record["stat"]
+		minute := record["minute"]
+		reason := disqualificationReason(played)
+
+		switch stat {
+		case "in":
+			if lastAction == "in" {
+				return fmt.Errorf("invalid sequence of 'in' - 'out' at minute %s", minute)
+			}
+			if reason != "" {
+				return fmt.Errorf("player %s, can't go in at minute %s", reason, minute)
+			}
+			lastAction = "in"
+		case "out":
+			if lastAction == "" {
+				return fmt.Errorf("player can't go out before in")
+			}
+			if lastAction == "out" {
+				return fmt.Errorf("invalid sequence of 'in' - 'out' at minute %s", minute)
+			}
+			lastAction = "out"
+		default:
+			if lastAction != "in" && !canBeRecordedOffCourt(stat) {
+				return fmt.Errorf("player is out at minute %s, can't add stat", minute)
+			}
+			if reason != "" {
+				return fmt.Errorf("player %s before minute %s", reason, minute)
+			}
+		}
+
+		played = append(played, item)
+	}
+
+	return nil
+}
+
+// validateStoredSequence validates a live stats list, either a player's or a team's own list
+func validateStoredSequence(playerID int, stats []string) error {
+	if playerID == 0 {
+		return validateTeamStatSequence(stats)
+	}
+	return validateStatSequence(stats)
+}
+
+func isInOut(stat string) bool {
+	return stat == "in" || stat == "out"
+}
+
+// statListEdits are the live stats lists a correction changes, as they are once it is applied
+type statListEdits map[string][]string
+
+// list returns a stats list as edited so far, reading it through rdb the first time
+func (e statListEdits) list(rdb redis.Cmdable, key string) ([]string, *matchStatError) {
+	if stats, ok := e[key]; ok {
+		return stats, nil
+	}
+	stats, err := rdb.LRange(db.Ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, &matchStatError{http.StatusInternalServerError, "Failed to read player stats from Redis"}
+	}
+	e[key] = stats
+	return stats, nil
+}
+
+// correctionKeys returns the keys a correction of a live match watches: every stats list of the
+// match and the event index
+func correctionKeys(matchID int) ([]string, error) {
+	keys, err := matchStatsKeys(matchID)
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, statIndexKey(matchID)), nil
+}
+
+func DeleteMatchEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+	eventID := vars["eventId"]
+
+	keys, err := correctionKeys(matchID)
+	if err != nil {
+		http.Error(w, "Failed to read match roster from Redis", http.StatusInternalServerError)
+		return
+	}
+
+	// The lists are read, validated and edited in one transaction, so a stat recorded meanwhile
+	// can't invalidate what was checked
+	streamed := matchStreamStore(matchID)
+	var events []MatchEvent
+	statErr := runMatchTx(matchID, keys, "Failed to delete event from Redis", func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, *matchStatError) {
+		event, statErr := findStatEvent(tx, matchID, eventID)
+		if statErr != nil {
+			return nil, statErr
+		}
+
+		edits := make(statListEdits)
+		stats, statErr := edits.list(tx, event.RedisKey)
+		if statErr != nil {
+			return nil, statErr
+		}
+		edits[event.RedisKey] = slices.DeleteFunc(slices.Clone(stats), func(raw string) bool { return raw == event.Raw })
+		if err := validateStoredSequence(event.PlayerID, edits[event.RedisKey]); err != nil {
+			return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Deleting event %s leaves an invalid sequence: %v", eventID, err)}
+		}
+
+		if isInOut(event.Record["stat"]) {
+			if statErr := validateCourtCorrection(tx, matchID, event.TeamID, edits); statErr != nil {
+				return nil, statErr
+			}
+		}
+
+		// Both sides of a linked play (e.g. a shot and its assist) are undone together
+		deleted := []*storedStat{event}
+		if linkedEventID := event.Record["linked_event_id"]; linkedEventID != "" {
+			linked, statErr := findStatEvent(tx, matchID, linkedEventID)
+			if statErr != nil && statErr.Status != http.StatusNotFound {
+				return nil, statErr
+			}
+			if linked != nil {
+				linkedStats, statErr := edits.list(tx, linked.RedisKey)
+				if statErr != nil {
+					return nil, statErr
+				}
+				edits[linked.RedisKey] = slices.DeleteFunc(slices.Clone(linkedStats), func(raw string) bool { return raw == linked.Raw })
+				if err := validateStatSequence(edits[linked.RedisKey]); err != nil {
+					return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Deleting linked event %s leaves an invalid sequence: %v", linkedEventID, err)}
+				}
+				deleted = append(deleted, linked)
+			}
+		}
+
+		events = nil
+		for _, ev := range deleted {
+			events = append(events, MatchEvent{
+				Type:           "delete",
+				MatchID:        matchID,
+				EventID:        ev.Record["id"],
+				TeamID:         ev.TeamID,
+				PlayerID:       ev.PlayerID,
+				Minute:         ev.Record["minute"],
+				Period:         periodOfRecord(ev.Record),
+				Stat:           ev.Record["stat"],
+				LinkedPlayerID: linkedPlayerOf(ev.Record),
+				LinkedEventID:  ev.Record["linked_event_id"],
+			})
+		}
+
+		if streamed {
+			// scored as the match will be once the events are gone
+			score := scoreMatchEvent(tx, MatchEvent{MatchID: matchID})
+			for i, ev := range deleted {
+				score = score.addPoints(ev.TeamID, -pointValues[ev.Record["stat"]])
+				events[i] = events[i].withScore(score)
+			}
+		}
+
+		return func(pipe redis.Pipeliner) error {
+			if streamed {
+				// projected to the lists from the stream
+				for _, ev := range events {
+					if err := addStreamEvent(pipe, ev, ""); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			for _, ev := range deleted {
+				pipe.LRem(db.Ctx, ev.RedisKey, 1, ev.Raw)
+				pipe.HDel(db.Ctx, statIndexKey(matchID), ev.Record["id"])
+			}
+			return nil
+		}, nil
+	})
+	if statErr != nil {
+		http.Error(w, statErr.Message, statErr.Status)
+		return
+	}
+
+	for _, ev := range events {
+		announceMatchEvent(ev)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func AmendMatchEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+	eventID := vars["eventId"]
+
+	// Omitted fields are left unchanged
+	var amendment struct {
+		PlayerID int    `json:"playerId"`
+		Minute   string `json:"minute"`
+		Period   int    `json:"period"`
+		Stat     string `json:"stat"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&amendment); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if amendment.Minute != "" && !isValidMinuteValue(amendment.Minute) {
+		http.Error(w, "Invalid minute value", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := correctionKeys(matchID)
+	if err != nil {
+		http.Error(w, "Failed to read match roster from Redis", http.StatusInternalServerError)
+		return
+	}
+
+	streamed := matchStreamStore(matchID)
+	var ev MatchEvent
+	statErr := runMatchTx(matchID, keys, "Failed to save amended event to Redis", func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, *matchStatError) {
+		event, statErr := findStatEvent(tx, matchID, eventID)
+		if statErr != nil {
+			return nil, statErr
+		}
+
+		if linkedEventID := event.Record["linked_event_id"]; linkedEventID != "" {
+			return nil, &matchStatError{http.StatusConflict, fmt.Sprintf("Event %s is linked to event %s, delete the play and enter it again", eventID, linkedEventID)}
+		}
+
+		amended := map[string]string{
+			"id":     eventID,
+			"minute": event.Record["minute"],
+			"period": strconv.Itoa(periodOfRecord(event.Record)),
+			"stat":   event.Record["stat"],
+		}
+		if amendment.Minute != "" {
+			amended["minute"] = amendment.Minute
+		}
+		if amendment.Minute != "" || amendment.Period != 0 {
+			period, err := resolveEventPeriod(matchID, amended["minute"], amendment.Period)
+			if err != nil {
+				return nil, &matchStatError{http.StatusBadRequest, err.Error()}
+			}
+			amended["period"] = strconv.Itoa(period)
+		}
+		if amendment.Stat != "" {
+			// a player's stat stays a player's stat and a team's stat a team's one
+			allowedStats := validStatsToAdd
+			if event.PlayerID == 0 {
+				allowedStats = validTeamStatsToAdd
+			}
+			if !slices.Contains(allowedStats, amendment.Stat) {
+				return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Invalid stat type. Available stats to amend to are: %v", allowedStats)}
+			}
+			amended["stat"] = recordedStat(amendment.Stat)
+		}
+
+		if event.PlayerID == 0 && amendment.PlayerID != 0 {
+			return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Event %s is a team stat, it can't be moved to a player", eventID)}
+		}
+
+		targetKey, targetTeamID, targetPlayerID := event.RedisKey, event.TeamID, event.PlayerID
+		if amendment.PlayerID != 0 && amendment.PlayerID != event.PlayerID {
+			teamIDStr, err := tx.Get(db.Ctx, fmt.Sprintf("match:%d:player:%d:team", matchID, amendment.PlayerID)).Result()
+			if err != nil {
+				return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Player %d is not part of match %d", amendment.PlayerID, matchID)}
+			}
+			targetTeamID, _ = strconv.Atoi(teamIDStr)
+			targetPlayerID = amendment.PlayerID
+			targetKey = playerStatsKey(matchID, targetTeamID, targetPlayerID)
+		}
+
+		amendedJSON, err := json.Marshal(amended)
+		if err != nil {
+			return nil, &matchStatError{http.StatusInternalServerError, "Failed to encode stat"}
+		}
+
+		edits := make(statListEdits)
+		sourceStats, statErr := edits.list(tx, event.RedisKey)
+		if statErr != nil {
+			return nil, statErr
+		}
+		edits[event.RedisKey] = slices.DeleteFunc(slices.Clone(sourceStats), func(raw string) bool { return raw == event.Raw })
+		targetStats, statErr := edits.list(tx, targetKey)
+		if statErr != nil {
+			return nil, statErr
+		}
+		edits[targetKey] = append(slices.Clone(targetStats), string(amendedJSON))
+
+		// Re-validate every list the correction touches
+		if targetKey == event.RedisKey {
+			if err := validateStoredSequence(event.PlayerID, edits[targetKey]); err != nil {
+				return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Amended event %s leaves an invalid sequence: %v", eventID, err)}
+			}
+		} else {
+			if err := validateStatSequence(edits[event.RedisKey]); err != nil {
+				return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Moving event %s leaves an invalid sequence for player %d: %v", eventID, event.PlayerID, err)}
+			}
+			if err := validateStatSequence(edits[targetKey]); err != nil {
+				return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Moving event %s leaves an invalid sequence for player %d: %v", eventID, targetPlayerID, err)}
+			}
+		}
+
+		// an "in" or "out" moved, or turned into another stat or the other way around, changes who is on court
+		if event.PlayerID != 0 && (isInOut(event.Record["stat"]) || isInOut(amended["stat"])) {
+			for _, teamID := range slices.Compact([]int{event.TeamID, targetTeamID}) {
+				if statErr := validateCourtCorrection(tx, matchID, teamID, edits); statErr != nil {
+					return nil, statErr
+				}
+			}
+		}
+
+		period, _ := strconv.Atoi(amended["period"])
+		ev = MatchEvent{
+			Type:           "amend",
+			MatchID:        matchID,
+			EventID:        eventID,
+			TeamID:         targetTeamID,
+			PlayerID:       targetPlayerID,
+			Minute:         amended["minute"],
+			Period:         period,
+			Stat:           amended["stat"],
+			LinkedPlayerID: linkedPlayerOf(amended),
+			LinkedEventID:  amended["linked_event_id"],
+		}
+
+		if streamed {
+			score := scoreMatchEvent(tx, MatchEvent{MatchID: matchID}).
+				addPoints(event.TeamID, -pointValues[event.Record["stat"]]).
+				addPoints(targetTeamID, pointValues[amended["stat"]])
+			ev = ev.withScore(score)
+		}
+
+		return func(pipe redis.Pipeliner) error {
+			if streamed {
+				// projected to the lists from the stream
+				return addStreamEvent(pipe, ev, string(amendedJSON))
+			}
+			pipe.LRem(db.Ctx, event.RedisKey, 1, event.Raw)
+			pipe.RPush(db.Ctx, targetKey, amendedJSON)
+			pipe.HSet(db.Ctx, statIndexKey(matchID), eventID, targetKey)
+			return nil
+		}, nil
+	})
+	if statErr != nil {
+		http.Error(w, statErr.Message, statErr.Status)
+		return
+	}
+
+	if err := advanceMatchPeriod(matchID, ev.Period); err != nil {
+		log.Printf("Failed to advance match %d to %s: %v", matchID, periodLabel(ev.Period), err)
+	}
+
+	ev = announceMatchEvent(ev)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ev)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"skyhawk/db"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// correctEvent sends a delete, or an amend with the given body, for an event of the test match
+func correctEvent(method, eventID, body string) int {
+	req := mux.SetURLVars(httptest.NewRequest(method, "/", strings.NewReader(body)), map[string]string{
+		"matchId": fmt.Sprint(testMatchID),
+		"eventId": eventID,
+	})
+	rec := httptest.NewRecorder()
+	if method == http.MethodDelete {
+		DeleteMatchEvent(rec, req)
+	} else {
+		AmendMatchEvent(rec, req)
+	}
+	return rec.Code
+}
+
+func TestCorrectionsKeepFiveOnCourt(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+	starter, sub := testHomeTeam*10+5, testHomeTeam*10+6
+
+	outID, _, err := pushStatRecord(testMatchID, playerStatsKey(testMatchID, testHomeTeam, starter), "10.00", 1, "out")
+	if err != nil {
+		t.Fatalf("failed to record out: %v", err)
+	}
+	inID, _, err := pushStatRecord(testMatchID, playerStatsKey(testMatchID, testHomeTeam, sub), "10.00", 1, "in")
+	if err != nil {
+		t.Fatalf("failed to record in: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		eventID string
+		body    string
+		want    int
+	}{
+		{"delete the in, four on court", http.MethodDelete, inID, "", http.StatusBadRequest},
+		{"in moved earlier, six on court", http.MethodPatch, inID, `{"minute":"05.00"}`, http.StatusBadRequest},
+		{"out moved later, six on court", http.MethodPatch, outID, `{"minute":"12.00"}`, http.StatusBadRequest},
+		{"in turned into a steal", http.MethodPatch, inID, `{"stat":"steals"}`, http.StatusBadRequest},
+		{"out moved earlier", http.MethodPatch, outID, `{"minute":"08.00"}`, http.StatusOK},
+	} {
+		if got := correctEvent(tc.method, tc.eventID, tc.body); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	players, _ := liveTeamPlayers(db.Redis, testMatchID, testHomeTeam)
+	if n := countOnCourt(players); n != playersOnCourt {
+		t.Errorf("team has %d players on court, want %d", n, playersOnCourt)
+	}
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+)
+
+// MatchEvent is a single accepted live event as pushed to stream subscribers.
+// Every event carries the running score after it was applied.
+type MatchEvent struct {
+	ID             int64  `json:"id"`
+	Type           string `json:"type"` // "start", "stat", "amend", "delete", "paused", "live", "end" or "cancelled"
+	MatchID        int    `json:"matchId"`
+	EventID        string `json:"eventId,omitempty"` // id of the underlying stat record
+	TeamID         int    `json:"teamId,omitempty"`
+	PlayerID       int    `json:"playerId,omitempty"`
+	Minute         string `json:"minute,omitempty"`
+	Period         int    `json:"period,omitempty"`
+	Stat           string `json:"stat,omitempty"`
+	LinkedPlayerID int    `json:"linkedPlayerId,omitempty"` // other side of the play, e.g. the assisting player
+	LinkedEventID  string `json:"linkedEventId,omitempty"`
+	HomeTeam       int    `json:"homeTeam"`
+	AwayTeam       int    `json:"awayTeam"`
+	HomeScore      int    `json:"homeScore"`
+	AwayScore      int    `json:"awayScore"`
+	Source         string `json:"source,omitempty"` // scorekeeper connection that entered the event, if any
+}
+
+const sseHeartbeatInterval = 15 * time.Second
+
+func matchEventsKey(matchID int) string {
+	return fmt.Sprintf("match:%d:events", matchID)
+}
+
+func matchEventsSeqKey(matchID int) string {
+	return fmt.Sprintf("match:%d:events:seq", matchID)
+}
+
+// Pub/Sub channel, deliberately outside the "match:*" key space so it is not
+// picked up by the key scans used for stats.
+func matchEventsChannel(matchID int) string {
+	return fmt.Sprintf("events:match:%d", matchID)
+}
+
+// publishEventScript assigns the next sequence id to an event, appends it to the match event log
+// and publishes it, all at once: concurrent publishers can't interleave, so the log holds event N
+// at index N-1 and subscribers receive events in id order.
+// KEYS: sequence, event log. ARGV: channel, event JSON.
+var publishEventScript = redis.NewScript(`
+local id = redis.call('INCR', KEYS[1])
+local ev = cjson.decode(ARGV[2])
+ev['id'] = id
+local payload = cjson.encode(ev)
+redis.call('RPUSH', KEYS[2], payload)
+redis.call('PUBLISH', ARGV[1], payload)
+return id
+`)
+
+// publishMatchEvent assigns the next sequence id to the event, appends it to the
+// match event log (used for Last-Event-ID resume) and notifies live subscribers.
+// Failures are logged only - the stat itself has already been recorded.
+func publishMatchEvent(ev MatchEvent) MatchEvent {
+	return logMatchEvent(scoreMatchEvent(db.Redis, ev))
+}
+
+// logMatchEvent is publishMatchEvent for an event scored already, e.g. when it was emitted
+func logMatchEvent(ev MatchEvent) MatchEvent {
+	eventJSON, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("Failed to encode event for match %d: %v", ev.MatchID, err)
+		return ev
+	}
+
+	keys := []string{matchEventsSeqKey(ev.MatchID), matchEventsKey(ev.MatchID)}
+	id, err := publishEventScript.Run(db.Ctx, db.Redis, keys, matchEventsChannel(ev.MatchID), eventJSON).Int64()
+	if err != nil {
+		log.Printf("Failed to publish event for match %d: %v", ev.MatchID, err)
+		return ev
+	}
+	ev.ID = id
+
+	return ev
+}
+
+// scoreMatchEvent sets the teams of the match and the current score on the event, read through
+// rdb, so a transaction can score the events it is about to append
+func scoreMatchEvent(rdb redis.Cmdable, ev MatchEvent) MatchEvent {
+	ev.HomeTeam, _ = rdb.Get(db.Ctx, fmt.Sprintf("match:%d:home_team", ev.MatchID)).Int()
+	ev.AwayTeam, _ = rdb.Get(db.Ctx, fmt.Sprintf("match:%d:away_team", ev.MatchID)).Int()
+	ev.HomeScore = matchTeamPoints(rdb, ev.MatchID, ev.HomeTeam)
+	ev.AwayScore = matchTeamPoints(rdb, ev.MatchID, ev.AwayTeam)
+	return ev
+}
+
+// withScore returns the event carrying the teams and score of another one
+func (ev MatchEvent) withScore(score MatchEvent) MatchEvent {
+	ev.HomeTeam, ev.AwayTeam = score.HomeTeam, score.AwayTeam
+	ev.HomeScore, ev.AwayScore = score.HomeScore, score.AwayScore
+	return ev
+}
+
+// addPoints moves the score carried by an event by the points scored by a team, e.g. by the
+// event itself when it is scored before it is applied
+func (ev MatchEvent) addPoints(teamID, points int) MatchEvent {
+	switch teamID {
+	case ev.HomeTeam:
+		ev.HomeScore += points
+	case ev.AwayTeam:
+		ev.AwayScore += points
+	}
+	return ev
+}
+
+// matchTeams returns the home and away team of a live match, as stored by StartMatch.
+func matchTeams(matchID int) (int, int) {
+	homeTeamID, _ := db.Redis.Get(db.Ctx, fmt.Sprintf("match:%d:home_team", matchID)).Int()
+	awayTeamID, _ := db.Redis.Get(db.Ctx, fmt.Sprintf("match:%d:away_team", matchID)).Int()
+	return homeTeamID, awayTeamID
+}
+
+// matchTeamPoints returns the points of a team in a live match, from its players' lists
+func matchTeamPoints(rdb redis.Cmdable, matchID, teamID int) int {
+	playerIDs, err := matchRosterPlayers(rdb, matchID, teamID)
+	if err != nil {
+		return 0
+	}
+
+	points := 0
+	for _, playerID := range playerIDs {
+		stats, err := rdb.LRange(db.Ctx, playerStatsKey(matchID, teamID, playerID), 0, -1).Result()
+		if err != nil {
+			continue
+		}
+		for _, raw := range stats {
+			var record map[string]string
+			if err := json.Unmarshal([]byte(raw), &record); err == nil {
+				points += pointValues[record["stat"]]
+			}
+		}
+	}
+	return points
+}
+
+func StreamMatchEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	// EventSource sends Last-Event-ID on reconnect; the query param allows resuming from a fresh connection
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastID < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Subscribe before replaying the log, so nothing published in between is lost
+	sub := db.Redis.Subscribe(r.Context(), matchEventsChannel(matchID))
+	defer sub.Close()
+	if _, err := sub.Receive(r.Context()); err != nil {
+		http.Error(w, "Failed to subscribe to match events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// Event ids are sequential from 1 and logged in order by publishEventScript, so the log index of event N is N-1
+	backlog, err := db.Redis.LRange(db.Ctx, matchEventsKey(matchID), lastID, -1).Result()
+	if err != nil {
+		log.Printf("Failed to read event log for match %d: %v", matchID, err)
+	}
+	for _, payload := range backlog {
+		id, ok := writeSSEEvent(w, payload, lastID)
+		if ok {
+			lastID = id
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			id, ok := writeSSEEvent(w, msg.Payload, lastID)
+			if ok {
+				lastID = id
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// writeSSEEvent writes a logged event in SSE framing, skipping events the
+// client has already seen. It returns the written event id.
+func writeSSEEvent(w http.ResponseWriter, payload string, lastID int64) (int64, bool) {
+	var ev MatchEvent
+	if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+		log.Printf("Failed to decode match event: %v", err)
+		return 0, false
+	}
+	if ev.ID <= lastID {
+		return 0, false
+	}
+
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, payload)
+	return ev.ID, true
+}
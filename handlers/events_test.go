@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"skyhawk/db"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentPublishKeepsIdOrder(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+
+	sub := db.Redis.Subscribe(db.Ctx, matchEventsChannel(testMatchID))
+	defer sub.Close()
+	if _, err := sub.Receive(db.Ctx); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	messages := sub.Channel()
+
+	const published = 20
+	var wg sync.WaitGroup
+	for i := 0; i < published; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			publishMatchEvent(MatchEvent{Type: "stat", MatchID: testMatchID})
+		}()
+	}
+	wg.Wait()
+
+	for want := int64(1); want <= published; want++ {
+		select {
+		case msg := <-messages:
+			var ev MatchEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+				t.Fatalf("failed to decode event: %v", err)
+			}
+			if ev.ID != want {
+				t.Fatalf("received event %d, want %d", ev.ID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d was not received", want)
+		}
+	}
+
+	logged, _ := db.Redis.LRange(db.Ctx, matchEventsKey(testMatchID), 0, -1).Result()
+	for i, payload := range logged {
+		var ev MatchEvent
+		if err := json.Unmarshal([]byte(payload), &ev); err != nil || ev.ID != int64(i+1) {
+			t.Errorf("log index %d holds event %d, want %d", i, ev.ID, i+1)
+		}
+	}
+	if len(logged) != published {
+		t.Errorf("logged %d events, want %d", len(logged), published)
+	}
+}
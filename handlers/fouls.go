@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// Personal fouls count towards a player's 6 foul limit and towards the team fouls.
+// Technical fouls count towards neither, they can only get a player ejected.
+var personalFoulStats = []string{"fouls", "flagrant1_fouls", "flagrant2_fouls"}
+
+const personalFoulLimit = 6
+
+// A player is ejected for a flagrant 2 foul, a second flagrant 1 or a second technical
+var ejectionRules = []struct {
+	stat   string
+	limit  int
+	reason string
+}{
+	{"flagrant2_fouls", 1, "was ejected for a flagrant 2 foul"},
+	{"flagrant1_fouls", 2, "was ejected for 2 flagrant 1 fouls"},
+	{"technical_fouls", 2, "was ejected for 2 technical fouls"},
+}
+
+func countPersonalFouls(stats []string) int {
+	count := 0
+	for _, item := range stats {
+		var record map[string]string
+		if err := json.Unmarshal([]byte(item), &record); err == nil && slices.Contains(personalFoulStats, record["stat"]) {
+			count++
+		}
+	}
+	return count
+}
+
+func hasReachedFoulLimit(stats []string) bool {
+	return countPersonalFouls(stats) >= personalFoulLimit
+}
+
+// ejectionReason returns why a player was ejected, "" if they weren't
+func ejectionReason(stats []string) string {
+	for _, rule := range ejectionRules {
+		if countStat(stats, rule.stat) >= rule.limit {
+			return rule.reason
+		}
+	}
+	return ""
+}
+
+// disqualificationReason returns why a player can't play any further, "" while they can
+func disqualificationReason(stats []string) string {
+	if reason := ejectionReason(stats); reason != "" {
+		return reason
+	}
+	if hasReachedFoulLimit(stats) {
+		return "reached 6 fouls"
+	}
+	return ""
+}
+
+func isDisqualified(stats []string) bool {
+	return disqualificationReason(stats) != ""
+}
+
+// canBeRecordedOffCourt reports whether a stat can be given to a player on the bench
+func canBeRecordedOffCourt(stat string) bool {
+	return stat == "technical_fouls"
+}
+
+func countStat(stats []string, stat string) int {
+	count := 0
+	for _, item := range stats {
+		var record map[string]string
+		if err := json.Unmarshal([]byte(item), &record); err == nil && record["stat"] == stat {
+			count++
+		}
+	}
+	return count
+}
@@ -6,14 +6,16 @@ import (
 	"io"
 	"net/http"
 	"skyhawk/db"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"database/sql"
 	"log"
 
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // TEAMS APIS //
@@ -414,10 +416,24 @@ func GetTeamActivePlayers(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetMatches(w http.ResponseWriter, r *http.Request) {
+	// Optional ?status=live,paused filter
+	var statuses []string
+	if query := r.URL.Query().Get("status"); query != "" {
+		for _, status := range strings.Split(query, ",") {
+			status = strings.ToLower(strings.TrimSpace(status))
+			if !slices.Contains(matchStatuses, status) {
+				http.Error(w, fmt.Sprintf("Invalid status %s. Available statuses are: %v", status, matchStatuses), http.StatusBadRequest)
+				return
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
 	// Query to select all matches from the database
 	rows, err := db.PG.Query(`
-		SELECT match_id, date, home_team, away_team, home_score, away_score FROM matches
-	`)
+		SELECT match_id, date, home_team, away_team, home_score, away_score, status FROM matches
+		WHERE $1::text[] IS NULL OR status = ANY($1)
+	`, pq.Array(statuses))
 
 	if err != nil {
 		// Handle error if the query fails
@@ -437,9 +453,10 @@ func GetMatches(w http.ResponseWriter, r *http.Request) {
 		var awayTeam int64
 		var homeScore int64
 		var awayScore int64
+		var status string
 
 		// Scan the row into variables
-		if err := rows.Scan(&matchID, &date, &homeTeam, &awayTeam, &homeScore, &awayScore); err != nil {
+		if err := rows.Scan(&matchID, &date, &homeTeam, &awayTeam, &homeScore, &awayScore, &status); err != nil {
 			http.Error(w, fmt.Sprintf("Error scanning row: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -452,6 +469,7 @@ func GetMatches(w http.ResponseWriter, r *http.Request) {
 			"away_team":  awayTeam,
 			"home_score": homeScore,
 			"away_score": awayScore,
+			"status":     status,
 		})
 	}
 
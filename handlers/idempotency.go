@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"strings"
+	"time"
+)
+
+const (
+	// How long a submission may stay in flight before a retry with the same key is allowed to take over
+	idempotencyPendingTTL = 30 * time.Second
+	// How long the outcome of a submission is replayed, longer than any match lasts
+	idempotencyResultTTL = 24 * time.Hour
+)
+
+// idempotentResult is the stored outcome of the first submission made with an idempotency key.
+type idempotentResult struct {
+	BodyHash string       `json:"bodyHash,omitempty"` // of the submission, see submissionHash
+	Status   int          `json:"status"`
+	Error    string       `json:"error,omitempty"`
+	Events   []MatchEvent `json:"events,omitempty"`
+}
+
+func idempotencyKey(matchID int, key string) string {
+	return fmt.Sprintf("match:%d:idempotency:%s", matchID, key)
+}
+
+// pendingSubmission is stored under an idempotency key while its first submission is in flight
+const pendingSubmission = "pending"
+
+// submissionHash identifies what was submitted under an idempotency key. The event id, which may
+// be the key itself, is left out, so the same stat hashes alike whichever channel sent it.
+func submissionHash(MatchStat MatchStatInput) string {
+	MatchStat.EventID = ""
+	submission, _ := json.Marshal(MatchStat)
+	sum := sha256.Sum256(submission)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordMatchStatOnce records a stat like recordMatchStat, but a repeated submission with the
+// same key within the match returns the original outcome (replayed = true) instead of recording
+// the stat again. Reusing a key for a different submission is rejected with 422. Conflicts and
+// server errors are not remembered, so they can be retried. An empty key disables the check.
+func recordMatchStatOnce(MatchStat MatchStatInput, key, source string) ([]MatchEvent, bool, *matchStatError) {
+	if key == "" {
+		events, err := recordMatchStat(MatchStat, source)
+		return events, false, err
+	}
+
+	redisKey := idempotencyKey(MatchStat.MatchID, key)
+	bodyHash := submissionHash(MatchStat)
+	mismatch := &matchStatError{http.StatusUnprocessableEntity, fmt.Sprintf("Key %s was already used for a different submission", key)}
+
+	claimed, err := db.Redis.SetNX(db.Ctx, redisKey, pendingSubmission+":"+bodyHash, idempotencyPendingTTL).Result()
+	if err != nil {
+		return nil, false, &matchStatError{http.StatusInternalServerError, "Failed to check idempotency key"}
+	}
+
+	if claimed {
+		// listed so the key is removed with the rest of the match once it is synced
+		if err := db.Redis.SAdd(db.Ctx, matchIdempotencyKeysKey(MatchStat.MatchID), key).Err(); err != nil {
+			log.Printf("Failed to index idempotency key %s in match %d: %v", key, MatchStat.MatchID, err)
+		}
+	} else {
+		stored, err := db.Redis.Get(db.Ctx, redisKey).Result()
+		if err != nil {
+			return nil, false, &matchStatError{http.StatusInternalServerError, "Failed to check idempotency key"}
+		}
+		if pendingHash, ok := strings.CutPrefix(stored, pendingSubmission); ok {
+			if pendingHash != "" && pendingHash != ":"+bodyHash {
+				return nil, false, mismatch
+			}
+			return nil, false, &matchStatError{http.StatusConflict, fmt.Sprintf("A submission with key %s is still in progress", key)}
+		}
+
+		var result idempotentResult
+		if err := json.Unmarshal([]byte(stored), &result); err != nil {
+			return nil, false, &matchStatError{http.StatusInternalServerError, "Failed to decode stored submission"}
+		}
+		// results stored before submissions were hashed have none to compare
+		if result.BodyHash != "" && result.BodyHash != bodyHash {
+			return nil, false, mismatch
+		}
+		if result.Status != http.StatusOK {
+			return nil, true, &matchStatError{result.Status, result.Error}
+		}
+		return result.Events, true, nil
+	}
+
+	events, statErr := recordMatchStat(MatchStat, source)
+
+	if statErr != nil && retryableStatus(statErr.Status) {
+		db.Redis.Del(db.Ctx, redisKey)
+		return nil, false, statErr
+	}
+
+	result := idempotentResult{BodyHash: bodyHash, Status: http.StatusOK, Events: events}
+	if statErr != nil {
+		result = idempotentResult{BodyHash: bodyHash, Status: statErr.Status, Error: statErr.Message}
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err == nil {
+		// kept for the rest of the match, removed with the other match keys on sync
+		err = db.Redis.Set(db.Ctx, redisKey, resultJSON, idempotencyResultTTL).Err()
+	}
+	if err != nil {
+		log.Printf("Failed to store result for idempotency key %s in match %d: %v", key, MatchStat.MatchID, err)
+	}
+
+	return events, false, statErr
+}
+
+// retryableStatus tells whether a failed submission may succeed when retried: a conflict such as
+// a paused match or concurrent updates, or a server error
+func retryableStatus(status int) bool {
+	return status == http.StatusConflict || status >= http.StatusInternalServerError
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"skyhawk/db"
+	"testing"
+)
+
+func TestIdempotencyKeyRejectsDifferentSubmission(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+	steal := MatchStatInput{MatchID: testMatchID, PlayerID: testHomeTeam*10 + 1, Minute: "02.00", Stat: "steals"}
+
+	first, replayed, statErr := recordMatchStatOnce(steal, "k1", "")
+	if statErr != nil || replayed {
+		t.Fatalf("first submission: replayed %v, error %v", replayed, statErr)
+	}
+
+	again, replayed, statErr := recordMatchStatOnce(steal, "k1", "")
+	if statErr != nil || !replayed || len(again) != len(first) || again[0].EventID != first[0].EventID {
+		t.Errorf("same submission: replayed %v, error %v, events %v, want the first events replayed", replayed, statErr, again)
+	}
+
+	block := steal
+	block.Stat = "blocks"
+	if _, _, statErr := recordMatchStatOnce(block, "k1", ""); statErr == nil || statErr.Status != http.StatusUnprocessableEntity {
+		t.Errorf("different submission with the same key: error %v, want 422", statErr)
+	}
+}
+
+func TestIdempotencyKeyRetriesConflict(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+	steal := MatchStatInput{MatchID: testMatchID, PlayerID: testHomeTeam*10 + 1, Minute: "02.00", Stat: "steals"}
+
+	db.Redis.Set(db.Ctx, matchPausedKey(testMatchID), "true", 0)
+	if _, _, statErr := recordMatchStatOnce(steal, "k1", ""); statErr == nil || statErr.Status != http.StatusConflict {
+		t.Fatalf("paused match: error %v, want 409", statErr)
+	}
+
+	db.Redis.Del(db.Ctx, matchPausedKey(testMatchID))
+	events, replayed, statErr := recordMatchStatOnce(steal, "k1", "")
+	if statErr != nil || replayed || len(events) == 0 {
+		t.Fatalf("retry after resuming: replayed %v, error %v, events %v, want the stat recorded", replayed, statErr, events)
+	}
+	if ttl := db.Redis.TTL(db.Ctx, idempotencyKey(testMatchID, "k1")).Val(); ttl <= 0 {
+		t.Errorf("stored result has TTL %v, want it to expire", ttl)
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"skyhawk/db"
+	"strconv"
+)
+
+// Redis key index.
+// Live reads never scan the keyspace with KEYS: the keys of a match are all derived from the
+// matches:active set, the teams of the match and their rosters (match:{id}:team:{t}:roster),
+// plus the set of idempotency keys used in the match.
+const activeMatchesKey = "matches:active"
+
+func matchIdempotencyKeysKey(matchID int) string {
+	return fmt.Sprintf("match:%d:idempotency", matchID)
+}
+
+// activeMatches returns the ids of the matches being played
+func activeMatches() ([]int, error) {
+	members, err := db.Redis.SMembers(db.Ctx, activeMatchesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var matchIDs []int
+	for _, member := range members {
+		if matchID, err := strconv.Atoi(member); err == nil {
+			matchIDs = append(matchIDs, matchID)
+		}
+	}
+	return matchIDs, nil
+}
+
+// teamPlayerStatsKeys returns the stats lists of a team's registered players in a live match
+func teamPlayerStatsKeys(matchID, teamID int) ([]string, error) {
+	playerIDs, err := matchRosterPlayers(db.Redis, matchID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, playerID := range playerIDs {
+		keys = append(keys, playerStatsKey(matchID, teamID, playerID))
+	}
+	return keys, nil
+}
+
+// matchStatsKeys returns the stats lists of both teams of a live match, players' and teams' own
+func matchStatsKeys(matchID int) ([]string, error) {
+	var keys []string
+
+	homeTeamID, awayTeamID := matchTeams(matchID)
+	for _, teamID := range []int{homeTeamID, awayTeamID} {
+		playerKeys, err := teamPlayerStatsKeys(matchID, teamID)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, playerKeys...)
+		keys = append(keys, teamStatsKey(matchID, teamID))
+	}
+
+	return keys, nil
+}
+
+// matchRedisKeys returns every Redis key a live match may have written
+func matchRedisKeys(matchID int) ([]string, error) {
+	keys := []string{
+		fmt.Sprintf("match:%d:started", matchID),
+		matchPausedKey(matchID),
+		fmt.Sprintf("match:%d:date", matchID),
+		fmt.Sprintf("match:%d:home_team", matchID),
+		fmt.Sprintf("match:%d:away_team", matchID),
+		fmt.Sprintf("match:%d:stats:seq", matchID),
+		matchPeriodKey(matchID),
+		statIndexKey(matchID),
+		matchEventsKey(matchID),
+		matchEventsSeqKey(matchID),
+		matchIdempotencyKeysKey(matchID),
+		matchLiveStoreKey(matchID),
+		matchProjectedKey(matchID),
+	}
+
+	homeTeamID, awayTeamID := matchTeams(matchID)
+	for _, teamID := range []int{homeTeamID, awayTeamID} {
+		playerIDs, err := matchRosterPlayers(db.Redis, matchID, teamID)
+		if err != nil {
+			return nil, err
+		}
+		for _, playerID := range playerIDs {
+			keys = append(keys,
+				playerStatsKey(matchID, teamID, playerID),
+				fmt.Sprintf("match:%d:player:%d:team", matchID, playerID),
+			)
+		}
+		keys = append(keys, teamStatsKey(matchID, teamID), matchRosterKey(matchID, teamID), matchStartersKey(matchID, teamID))
+	}
+
+	idempotencyKeys, err := db.Redis.SMembers(db.Ctx, matchIdempotencyKeysKey(matchID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range idempotencyKeys {
+		keys = append(keys, idempotencyKey(matchID, key))
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// lineupStats is how a five-man unit did while on court together
+type lineupStats struct {
+	TeamID          int      `json:"teamId"`
+	Players         []int    `json:"players"` // sorted by id
+	PlayerNames     []string `json:"playerNames"`
+	Matches         int      `json:"matches"`
+	Minutes         string   `json:"minutes"`
+	PointsFor       int      `json:"pointsFor"`
+	PointsAgainst   int      `json:"pointsAgainst"`
+	PlusMinus       int      `json:"plusMinus"`
+	Possessions     float64  `json:"possessions"`
+	OffensiveRating float64  `json:"offensiveRating"`
+	DefensiveRating float64  `json:"defensiveRating"`
+	NetRating       float64  `json:"netRating"`
+
+	seconds int
+	offense possessionCounts // the unit's own
+	defense possessionCounts // the opponent's, while the unit was on court
+	matches map[int]bool
+}
+
+func lineupKey(teamID int, players []int) string {
+	ids := make([]string, len(players))
+	for i, playerID := range players {
+		ids[i] = strconv.Itoa(playerID)
+	}
+	return fmt.Sprintf("%d:%s", teamID, strings.Join(ids, "-"))
+}
+
+// finish derives the reported totals and ratings from what was counted
+func (l *lineupStats) finish() {
+	l.Matches = len(l.matches)
+	l.Minutes = formatSeconds(l.seconds)
+	l.PointsFor = l.offense.Points
+	l.PointsAgainst = l.defense.Points
+	l.PlusMinus = l.PointsFor - l.PointsAgainst
+
+	offensive := l.offense.possessions()
+	defensive := l.defense.possessions()
+	l.Possessions = roundTenth((offensive + defensive) / 2)
+	l.OffensiveRating = rating(l.PointsFor, offensive)
+	l.DefensiveRating = rating(l.PointsAgainst, defensive)
+	l.NetRating = roundTenth(l.OffensiveRating - l.DefensiveRating)
+}
+
+// addMatchLineups replays the time-ordered records of a match into the lineups, keyed by team
+// and players. Time, points and possessions count towards the five players of each team on
+// court; while a team has any other number on court (mid-substitution) nothing is counted for it.
+// Lineups still on court at the end of a live match count until lastSecond.
+func addMatchLineups(lineups map[string]*lineupStats, matchID int, records []matchRecord, lastSecond int) {
+	onCourt := make(map[int][]int) // team -> players on court, sorted
+	current := func(teamID int) *lineupStats {
+		players := onCourt[teamID]
+		if len(players) != playersOnCourt {
+			return nil
+		}
+		key := lineupKey(teamID, players)
+		lineup, ok := lineups[key]
+		if !ok {
+			lineup = &lineupStats{TeamID: teamID, Players: slices.Clone(players), matches: make(map[int]bool)}
+			lineups[key] = lineup
+		}
+		lineup.matches[matchID] = true
+		return lineup
+	}
+
+	elapse := func(until int, since int) {
+		for teamID := range onCourt {
+			if lineup := current(teamID); lineup != nil && until > since {
+				lineup.seconds += until - since
+			}
+		}
+	}
+
+	previous := 0
+	for _, record := range records {
+		second := minuteToSeconds(record.Minute)
+		elapse(second, previous)
+		previous = max(previous, second)
+
+		switch record.Stat {
+		case "in":
+			if !slices.Contains(onCourt[record.TeamID], record.PlayerID) {
+				onCourt[record.TeamID] = append(onCourt[record.TeamID], record.PlayerID)
+				slices.Sort(onCourt[record.TeamID])
+			}
+			continue
+		case "out":
+			onCourt[record.TeamID] = slices.DeleteFunc(onCourt[record.TeamID], func(playerID int) bool { return playerID == record.PlayerID })
+			continue
+		}
+
+		for teamID := range onCourt {
+			lineup := current(teamID)
+			if lineup == nil {
+				continue
+			}
+			if teamID == record.TeamID {
+				lineup.offense.add(record.Stat)
+			} else {
+				lineup.defense.add(record.Stat)
+			}
+		}
+	}
+
+	elapse(lastSecond, previous)
+}
+
+// finishLineups returns the lineups with their totals, most minutes first
+func finishLineups(lineups map[string]*lineupStats) []lineupStats {
+	var playerIDs []int
+	for _, lineup := range lineups {
+		playerIDs = append(playerIDs, lineup.Players...)
+	}
+	names, err := playerNames(playerIDs)
+	if err != nil {
+		log.Printf("Failed to read player names of lineups: %v", err)
+	}
+
+	result := []lineupStats{}
+	for _, lineup := range lineups {
+		lineup.finish()
+		for _, playerID := range lineup.Players {
+			lineup.PlayerNames = append(lineup.PlayerNames, names[playerID])
+		}
+		result = append(result, *lineup)
+	}
+
+	slices.SortFunc(result, func(a, b lineupStats) int {
+		return cmp.Or(cmp.Compare(b.seconds, a.seconds), strings.Compare(lineupKey(a.TeamID, a.Players), lineupKey(b.TeamID, b.Players)))
+	})
+	return result
+}
+
+// GetMatchLineups returns every five-man unit of a match, live or synced, ?teamId= for one team
+func GetMatchLineups(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+
+	var teamID int
+	if teamIDStr := r.URL.Query().Get("teamId"); teamIDStr != "" {
+		if teamID, err = strconv.Atoi(teamIDStr); err != nil {
+			http.Error(w, "Invalid teamId format", http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, live, err := loadMatchRecords(matchID)
+	if err != nil {
+		log.Printf("Failed to load events of match %d: %v", matchID, err)
+		http.Error(w, "Failed to load match events", http.StatusInternalServerError)
+		return
+	}
+
+	lastSecond := 0
+	if live {
+		for _, record := range records {
+			lastSecond = max(lastSecond, minuteToSeconds(record.Minute))
+		}
+	}
+
+	lineups := make(map[string]*lineupStats)
+	addMatchLineups(lineups, matchID, records, lastSecond)
+	if teamID != 0 {
+		for key, lineup := range lineups {
+			if lineup.TeamID != teamID {
+				delete(lineups, key)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"matchId": matchID,
+		"live":    live,
+		"lineups": finishLineups(lineups),
+	})
+}
+
+// lineupSorts are the orders top lineups can be ranked by, best first
+var lineupSorts = map[string]func(a, b lineupStats) int{
+	"net_rating":       func(a, b lineupStats) int { return cmp.Compare(b.NetRating, a.NetRating) },
+	"offensive_rating": func(a, b lineupStats) int { return cmp.Compare(b.OffensiveRating, a.OffensiveRating) },
+	"defensive_rating": func(a, b lineupStats) int { return cmp.Compare(a.DefensiveRating, b.DefensiveRating) }, // fewer allowed is better
+	"plus_minus":       func(a, b lineupStats) int { return cmp.Compare(b.PlusMinus, a.PlusMinus) },
+	"minutes":          func(a, b lineupStats) int { return cmp.Compare(b.seconds, a.seconds) },
+}
+
+// GetTopLineups ranks a team's five-man units over a season, taken from 'matches_stats'.
+// ?sort= one of lineupSorts (net_rating by default), ?limit= (5 by default, 0 for all) and
+// ?min_minutes= (10 by default) to leave out units that barely played.
+func GetTopLineups(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	season := vars["season"]
+	teamID, err := strconv.Atoi(vars["teamId"])
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	sortBy := cmp.Or(query.Get("sort"), "net_rating")
+	compare, ok := lineupSorts[sortBy]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Invalid sort %s", sortBy), http.StatusBadRequest)
+		return
+	}
+	limit, err := strconv.Atoi(cmp.Or(query.Get("limit"), "5"))
+	if err != nil || limit < 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	minMinutes, err := strconv.Atoi(cmp.Or(query.Get("min_minutes"), "10"))
+	if err != nil || minMinutes < 0 {
+		http.Error(w, "Invalid min_minutes", http.StatusBadRequest)
+		return
+	}
+
+	matchIDs, err := seasonMatches("team_id", teamID, season)
+	if err != nil {
+		log.Printf("Error querying team matches: %v", err)
+		http.Error(w, "Error querying team matches", http.StatusInternalServerError)
+		return
+	}
+
+	lineups := make(map[string]*lineupStats)
+	for _, matchID := range matchIDs {
+		records, _, err := loadMatchRecords(matchID)
+		if err != nil {
+			log.Printf("Failed to load events of match %d: %v", matchID, err)
+			http.Error(w, "Failed to load match events", http.StatusInternalServerError)
+			return
+		}
+		addMatchLineups(lineups, matchID, records, 0)
+	}
+
+	for key, lineup := range lineups {
+		if lineup.TeamID != teamID || lineup.seconds < minMinutes*60 {
+			delete(lineups, key)
+		}
+	}
+
+	top := finishLineups(lineups)
+	slices.SortStableFunc(top, compare)
+	if limit > 0 && len(top) > limit {
+		top = top[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"teamId":  teamID,
+		"season":  season,
+		"sort":    sortBy,
+		"lineups": top,
+	})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestAddMatchLineups(t *testing.T) {
+	var records []matchRecord
+	for i := 1; i <= playersOnCourt; i++ {
+		records = append(records,
+			matchRecord{TeamID: testHomeTeam, PlayerID: testHomeTeam*10 + i, Minute: "00.00", Stat: "in"},
+			matchRecord{TeamID: testAwayTeam, PlayerID: testAwayTeam*10 + i, Minute: "00.00", Stat: "in"},
+		)
+	}
+	records = append(records,
+		matchRecord{TeamID: testHomeTeam, PlayerID: 101, Minute: "01.00", Stat: "3pt"},
+		matchRecord{TeamID: testAwayTeam, PlayerID: 201, Minute: "01.30", Stat: "2pt_miss"},
+		matchRecord{TeamID: testAwayTeam, PlayerID: 202, Minute: "01.35", Stat: "offensive_rebounds"},
+		matchRecord{TeamID: testAwayTeam, PlayerID: 202, Minute: "01.40", Stat: "2pt"},
+		// home swaps 105 for 106 at 02.00
+		matchRecord{TeamID: testHomeTeam, PlayerID: 105, Minute: "02.00", Stat: "out"},
+		matchRecord{TeamID: testHomeTeam, PlayerID: 106, Minute: "02.00", Stat: "in"},
+		matchRecord{TeamID: testHomeTeam, PlayerID: 106, Minute: "03.00", Stat: "turnovers"},
+	)
+
+	lineups := make(map[string]*lineupStats)
+	addMatchLineups(lineups, testMatchID, records, 4*60)
+
+	starters := lineups[lineupKey(testHomeTeam, []int{101, 102, 103, 104, 105})]
+	second := lineups[lineupKey(testHomeTeam, []int{101, 102, 103, 104, 106})]
+	away := lineups[lineupKey(testAwayTeam, []int{201, 202, 203, 204, 205})]
+	if starters == nil || second == nil || away == nil || len(lineups) != 3 {
+		t.Fatalf("unexpected lineups %v", slices.Collect(maps.Keys(lineups)))
+	}
+
+	for _, l := range []*lineupStats{starters, second, away} {
+		l.finish()
+	}
+
+	if starters.Minutes != "02.00" || second.Minutes != "02.00" || away.Minutes != "04.00" {
+		t.Errorf("minutes %s, %s, %s, want 02.00, 02.00, 04.00", starters.Minutes, second.Minutes, away.Minutes)
+	}
+	if starters.PointsFor != 3 || starters.PointsAgainst != 2 || starters.PlusMinus != 1 {
+		t.Errorf("starters scored %d and allowed %d", starters.PointsFor, starters.PointsAgainst)
+	}
+	// home used one possession (a made 3pt) and the away team one (miss, offensive rebound, made 2pt)
+	if starters.Possessions != 1 || starters.OffensiveRating != 300 || starters.DefensiveRating != 200 || starters.NetRating != 100 {
+		t.Errorf("starters possessions %v, ratings %v/%v/%v", starters.Possessions, starters.OffensiveRating, starters.DefensiveRating, starters.NetRating)
+	}
+	if second.PointsFor != 0 || second.PointsAgainst != 0 || second.offense.TOV != 1 {
+		t.Errorf("second unit scored %d, allowed %d, with %d turnovers", second.PointsFor, second.PointsAgainst, second.offense.TOV)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// linkedPlay is the second side of a play submitted along with a stat,
+// e.g. the assist on a made shot.
+type linkedPlay struct {
+	PlayerID int
+	Stat     string // stat credited to the linked player
+	Teammate bool   // whether the linked player plays for the same team
+}
+
+// linkedPlay returns the linked side of the submission, if any,
+// checking it fits the submitted stat.
+func (m MatchStatInput) linkedPlay() (*linkedPlay, *matchStatError) {
+	var linked []linkedPlay
+	if m.AssistPlayerID != 0 {
+		if m.Stat != "2pt" && m.Stat != "3pt" {
+			return nil, &matchStatError{http.StatusBadRequest, "An assist can only be linked to a made 2pt or 3pt"}
+		}
+		linked = append(linked, linkedPlay{m.AssistPlayerID, "assists", true})
+	}
+	if m.BlockPlayerID != 0 {
+		if m.Stat != "2pt_miss" && m.Stat != "3pt_miss" {
+			return nil, &matchStatError{http.StatusBadRequest, "A block can only be linked to a missed 2pt or 3pt"}
+		}
+		linked = append(linked, linkedPlay{m.BlockPlayerID, "blocks", false})
+	}
+	if m.StealPlayerID != 0 {
+		if m.Stat != "turnovers" {
+			return nil, &matchStatError{http.StatusBadRequest, "A steal can only be linked to a turnover"}
+		}
+		linked = append(linked, linkedPlay{m.StealPlayerID, "steals", false})
+	}
+
+	switch len(linked) {
+	case 0:
+		return nil, nil
+	case 1:
+		if linked[0].PlayerID == m.PlayerID {
+			return nil, &matchStatError{http.StatusBadRequest, "A player can't be linked to their own play"}
+		}
+		return &linked[0], nil
+	default:
+		return nil, &matchStatError{http.StatusBadRequest, "Only one linked player can be given per stat"}
+	}
+}
+
+// linkRecords points two live stat records at each other
+func linkRecords(record map[string]string, playerID int, linkedRecord map[string]string, linkedPlayerID int) {
+	record["linked_player_id"] = strconv.Itoa(linkedPlayerID)
+	record["linked_event_id"] = linkedRecord["id"]
+	linkedRecord["linked_player_id"] = strconv.Itoa(playerID)
+	linkedRecord["linked_event_id"] = record["id"]
+}
+
+// linkedPlayerOf returns the player linked to a live stat record, 0 if none
+func linkedPlayerOf(record map[string]string) int {
+	playerID, _ := strconv.Atoi(record["linked_player_id"])
+	return playerID
+}
+
+// GetAssistNetwork returns who assisted whom for a team over a season, taken from 'matches_stats'
+func GetAssistNetwork(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	season := vars["season"]
+	teamID, err := strconv.Atoi(vars["teamId"])
+	if err != nil {
+		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := db.PG.Query(`
+		SELECT a.player_id AS assister_id, a.linked_player_id AS scorer_id,
+			COUNT(*) AS assists,
+			COALESCE(SUM(CASE s.stat WHEN '2pt' THEN 2 WHEN '3pt' THEN 3 ELSE 0 END), 0) AS points
+		FROM matches_stats a
+		LEFT JOIN matches_stats s
+			ON s.match_id = a.match_id AND s.event_id = a.linked_event_id
+		WHERE a.team_id = $1 AND a.stat = 'assists' AND a.linked_player_id IS NOT NULL
+			AND EXTRACT(YEAR FROM a.match_date) = $2
+		GROUP BY a.player_id, a.linked_player_id
+		ORDER BY assists DESC
+	`, teamID, season)
+	if err != nil {
+		log.Printf("Error querying assist network: %v", err)
+		http.Error(w, "Error querying assist network", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	type assistLink struct {
+		AssisterID int `json:"assisterId"`
+		ScorerID   int `json:"scorerId"`
+		Assists    int `json:"assists"`
+		Points     int `json:"points"`
+	}
+
+	links := []assistLink{}
+	for rows.Next() {
+		var link assistLink
+		if err := rows.Scan(&link.AssisterID, &link.ScorerID, &link.Assists, &link.Points); err != nil {
+			log.Printf("Row scan error: %v", err)
+			continue
+		}
+		links = append(links, link)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"skyhawk/db"
 	"slices"
@@ -11,16 +12,39 @@ import (
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
 )
 
 var validStatsToAdd = []string{
-	"rebounds", "assists", "steals", "blocks", "turnovers",
-	"fouls", "in", "out", "1pt", "2pt", "3pt",
+	"offensive_rebounds", "defensive_rebounds", "assists", "steals", "blocks", "turnovers",
+	"fouls", "technical_fouls", "flagrant1_fouls", "flagrant2_fouls",
+	"in", "out", "1pt", "2pt", "3pt",
+	"1pt_miss", "2pt_miss", "3pt_miss",
+	"rebounds", // from clients that predate the split, recorded as unknownReboundStat
 }
 
-var validStatsToFetch = []string{
-	"rebounds", "assists", "steals", "blocks", "turnovers",
-	"fouls", "minutes", "1pt", "2pt", "3pt", "points",
+var validStatsToFetch = append([]string{
+	"rebounds", "offensive_rebounds", "defensive_rebounds", unknownReboundStat,
+	"assists", "steals", "blocks", "turnovers",
+	"fouls", "technical_fouls", "flagrant1_fouls", "flagrant2_fouls",
+	"bench_technical_fouls", "coach_technical_fouls", "full_timeouts", "short_timeouts",
+	"minutes", "1pt", "2pt", "3pt", "points", "plus_minus",
+	"1pt_miss", "2pt_miss", "3pt_miss",
+}, slices.Concat(shootingStats, teamFoulStats, timeoutStats, tempoStats)...)
+
+// Rebounds recorded before the offensive/defensive split, or still sent as plain "rebounds", have
+// no known type and are stored as unknownReboundStat, in Redis and in 'matches_stats' alike.
+// "rebounds" is always reported as the total of all three.
+const unknownReboundStat = "unknown_rebounds"
+
+var reboundStats = []string{"offensive_rebounds", "defensive_rebounds", unknownReboundStat}
+
+// recordedStat returns the stat a submitted or stored stat counts as
+func recordedStat(stat string) string {
+	if stat == "rebounds" {
+		return unknownReboundStat
+	}
+	return stat
 }
 
 var pointValues = map[string]int{
@@ -51,13 +75,14 @@ func StartMatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var teamPlayers map[int][]int
-	if err := json.NewDecoder(r.Body).Decode(&teamPlayers); err != nil {
+	// Each team sends its full active roster: the 5 starters and the bench
+	var teamRosters map[int]matchRoster
+	if err := json.NewDecoder(r.Body).Decode(&teamRosters); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if len(teamPlayers) != 2 {
+	if len(teamRosters) != 2 {
 		http.Error(w, "2 teams must be provided", http.StatusBadRequest)
 		return
 	}
@@ -73,78 +98,100 @@ func StartMatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for teamID, players := range teamPlayers {
+	// Validate both rosters before writing anything, so a rejected start leaves nothing behind
+	for teamID, roster := range teamRosters {
 		if teamID != homeTeamID && teamID != awayTeamID {
 			http.Error(w, fmt.Sprintf("Team %d is not part of match %d", teamID, matchID), http.StatusBadRequest)
 			return
 		}
 
-		if len(players) != 5 {
-			http.Error(w, fmt.Sprintf("Team %d must have exactly 5 players", teamID), http.StatusBadRequest)
+		if statErr := validateMatchRoster(teamID, roster); statErr != nil {
+			http.Error(w, statErr.Message, statErr.Status)
 			return
 		}
+	}
 
-		// Fetch valid player IDs with no end_date
-		rows, err := db.PG.Query(`
-			SELECT player_id FROM player_team_history
-			WHERE team_id = $1 AND end_date IS NULL
-		`, teamID)
-		if err != nil {
-			http.Error(w, "Failed to query player-team history", http.StatusInternalServerError)
-			return
+	// Only a scheduled match can start. Claiming it first keeps two concurrent starts from both
+	// setting it up; it goes back to scheduled if the setup fails.
+	if statErr := transitionMatchStatus(matchID, matchLive); statErr != nil {
+		http.Error(w, statErr.Message, statErr.Status)
+		return
+	}
+	setUp := false
+	defer func() {
+		if !setUp {
+			revertMatchStatus(matchID, matchScheduled, matchLive)
 		}
-		defer rows.Close()
+	}()
 
-		validPlayers := make(map[int]bool)
-		for rows.Next() {
-			var pid int
-			if err := rows.Scan(&pid); err == nil {
-				validPlayers[pid] = true
-			}
-		}
+	if err := db.Redis.Set(db.Ctx, fmt.Sprintf("match:%d:date", matchID), date, 0).Err(); err != nil {
+		http.Error(w, "Failed to mark match date", http.StatusInternalServerError)
+		return
+	}
 
-		for _, playerID := range players {
-			if !validPlayers[playerID] {
-				http.Error(w, fmt.Sprintf("Player %d is not currently on team %d", playerID, teamID), http.StatusBadRequest)
-				return
-			}
-		}
+	if err := db.Redis.Set(db.Ctx, fmt.Sprintf("match:%d:home_team", matchID), homeTeamID, 0).Err(); err != nil {
+		http.Error(w, "Failed to mark match home team", http.StatusInternalServerError)
+		return
+	}
+
+	if err := db.Redis.Set(db.Ctx, fmt.Sprintf("match:%d:away_team", matchID), awayTeamID, 0).Err(); err != nil {
+		http.Error(w, "Failed to mark match away team", http.StatusInternalServerError)
+		return
+	}
 
-		if err := db.Redis.Set(db.Ctx, fmt.Sprintf("match:%d:date", matchID), date, 0).Err(); err != nil {
-			http.Error(w, "Failed to mark match date", http.StatusInternalServerError)
+	if streamStore() {
+		if err := startMatchStream(matchID); err != nil {
+			http.Error(w, "Failed to create match stream", http.StatusInternalServerError)
 			return
 		}
+	}
 
-		for _, playerID := range players {
-			redisKey := fmt.Sprintf("match:%d:team:%d:player:%d:stats", matchID, teamID, playerID)
+	for teamID, roster := range teamRosters {
+		for _, playerID := range roster.players() {
+			playerTeamKey := fmt.Sprintf("match:%d:player:%d:team", matchID, playerID)
+			if err := db.Redis.Set(db.Ctx, playerTeamKey, teamID, 0).Err(); err != nil {
+				http.Error(w, "Failed to map player to team in Redis", http.StatusInternalServerError)
+				return
+			}
 
-			statJSON, err := json.Marshal(map[string]string{
-				"minute": "00.00",
-				"stat":   "in",
-			})
-			if err != nil {
-				http.Error(w, "Failed to encode stat", http.StatusInternalServerError)
+			if err := db.Redis.SAdd(db.Ctx, matchRosterKey(matchID, teamID), playerID).Err(); err != nil {
+				http.Error(w, "Failed to save roster to Redis", http.StatusInternalServerError)
 				return
 			}
+		}
 
-			if err := db.Redis.RPush(db.Ctx, redisKey, statJSON).Err(); err != nil {
-				http.Error(w, "Failed to save stat to Redis", http.StatusInternalServerError)
+		for _, playerID := range roster.Starters {
+			if err := db.Redis.SAdd(db.Ctx, matchStartersKey(matchID, teamID), playerID).Err(); err != nil {
+				http.Error(w, "Failed to save roster to Redis", http.StatusInternalServerError)
 				return
 			}
 
-			playerTeamKey := fmt.Sprintf("match:%d:player:%d:team", matchID, playerID)
-			if err := db.Redis.Set(db.Ctx, playerTeamKey, teamID, 0).Err(); err != nil {
-				http.Error(w, "Failed to map player to team in Redis", http.StatusInternalServerError)
+			redisKey := fmt.Sprintf("match:%d:team:%d:player:%d:stats", matchID, teamID, playerID)
+			if _, _, err := pushStatRecord(matchID, redisKey, "00.00", 1, "in"); err != nil {
+				http.Error(w, "Failed to save stat to Redis", http.StatusInternalServerError)
 				return
 			}
 		}
 	}
 
+	if err := db.Redis.Set(db.Ctx, matchPeriodKey(matchID), 1, 0).Err(); err != nil {
+		http.Error(w, "Failed to set match period", http.StatusInternalServerError)
+		return
+	}
+
 	if err := db.Redis.Set(db.Ctx, startKey, "true", 0).Err(); err != nil {
 		http.Error(w, "Failed to mark match as started", http.StatusInternalServerError)
 		return
 	}
 
+	if err := db.Redis.SAdd(db.Ctx, activeMatchesKey, matchID).Err(); err != nil {
+		http.Error(w, "Failed to register match as active", http.StatusInternalServerError)
+		return
+	}
+
+	setUp = true
+	emitMatchEvent(MatchEvent{Type: "start", MatchID: matchID, Minute: "00.00", Period: 1})
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -162,254 +209,412 @@ func EndMatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get all player stat keys for the match
-	pattern := fmt.Sprintf("match:%d:team:*:player:*", matchID)
-	iter := db.Redis.Scan(db.Ctx, 0, pattern, 0).Iterator()
-	for iter.Next(db.Ctx) {
-		playerKey := iter.Val()
-
-		endMatchJSON, _ := json.Marshal(map[string]string{
-			"minute": "48.00",
-			"stat":   "out",
-		})
+	status, err := matchStatus(matchID)
+	if err != nil {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
 
-		if err := db.Redis.RPush(db.Ctx, playerKey, endMatchJSON).Err(); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to save stat to Redis for key %s", playerKey), http.StatusInternalServerError)
+	// A live or paused match ends once. Ending it again only retries the sync of a match whose
+	// earlier sync failed, or reports the outcome of the one that succeeded.
+	ending := status == matchLive || status == matchPaused
+	if ending {
+		if statErr := transitionMatchStatus(matchID, matchFinal); statErr != nil {
+			http.Error(w, statErr.Message, statErr.Status)
 			return
 		}
-	}
-	if err := iter.Err(); err != nil {
-		http.Error(w, "Error scanning Redis keys", http.StatusInternalServerError)
+	} else if status != matchFinal && status != matchSynced {
+		http.Error(w, fmt.Sprintf("Match %d is %s, it can't end", matchID, status), http.StatusConflict)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Match ended and stats updated."))
-
-	// Sync Match from Redis into Database
-	syncMatch(matchID)
-}
-
-func syncMatch(matchID int) {
-	redisKey := fmt.Sprintf("match:%d:team:*:player:*:stats", matchID)
-
-	keys, err := db.Redis.Keys(db.Ctx, redisKey).Result()
-	if err != nil {
-		log.Printf("Failed to fetch keys for match %d: %v", matchID, err)
-		return
+	if isLiveMatch(matchID) {
+		if statErr := closeMatchStints(matchID, ending); statErr != nil {
+			http.Error(w, statErr.Message, statErr.Status)
+			return
+		}
 	}
 
-	matchDate, err := db.Redis.Get(db.Ctx, fmt.Sprintf("match:%d:date", matchID)).Result()
+	// Sync Match from Redis into Database, Redis is kept until it is stored.
+	// A failed sync is queued and retried by the sync worker.
+	result, err := runMatchSync(matchID)
 	if err != nil {
-		log.Printf("Failed to read match date: %v", err)
+		log.Printf("Failed to sync match %d, queued for retry: %v", matchID, err)
+		writeQueuedSyncJob(w, matchID, err)
 		return
 	}
 
-	successfullySynced := true
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
 
-	for _, key := range keys {
-		stats, err := db.Redis.LRange(db.Ctx, key, 0, -1).Result()
+// closeMatchStints records an "out" at the end of the last period for every player still on court,
+// and announces the end of the match. Players already out are skipped, so closing again after a
+// failed sync adds nothing.
+func closeMatchStints(matchID int, ending bool) *matchStatError {
+	// The match ends with the last period played, overtimes included
+	finalPeriod := currentMatchPeriod(matchID)
+	finalMinute := formatSeconds(periodEndSeconds(finalPeriod))
+
+	// Get all registered players of the match
+	closed := 0
+	homeTeamID, awayTeamID := matchTeams(matchID)
+	for _, teamID := range []int{homeTeamID, awayTeamID} {
+		players, err := liveTeamPlayers(db.Redis, matchID, teamID)
 		if err != nil {
-			log.Printf("Failed to fetch stats for key %s: %v", key, err)
-			continue
+			return &matchStatError{http.StatusInternalServerError, err.Error()}
 		}
 
-		for _, stat := range stats {
-			var statData map[string]interface{}
-			if err := json.Unmarshal([]byte(stat), &statData); err != nil {
-				log.Printf("Failed to unmarshal stat data: %v", err)
-				successfullySynced = false
+		for _, p := range players {
+			// Only players on court have a stint to close
+			if !p.onCourt() {
 				continue
 			}
 
-			minute := statData["minute"].(string)
-			statType := statData["stat"].(string)
-
-			parts := strings.Split(key, ":")
-			teamID := parts[3]
-			playerID := parts[5]
-
-			_, err := db.PG.Exec(`
-				INSERT INTO matches_stats (match_id, team_id, player_id, minute, stat, match_date)
-				VALUES ($1, $2, $3, $4, $5, $6)
-			`, matchID, teamID, playerID, minute, statType, matchDate)
-			if err != nil {
-				log.Printf("Failed to insert stat into database: %v", err)
-				successfullySynced = false
-				break
+			if _, _, err := pushStatRecord(matchID, p.RedisKey, finalMinute, finalPeriod, "out"); err != nil {
+				return &matchStatError{http.StatusInternalServerError, fmt.Sprintf("Failed to save stat to Redis for key %s", p.RedisKey)}
 			}
+			closed++
 		}
 	}
 
-	var homeTeamID, awayTeamID int
-	err = db.PG.QueryRow(`
-				SELECT home_team, away_team FROM matches WHERE match_id = $1
-			`, matchID).Scan(&homeTeamID, &awayTeamID)
-	if err != nil {
-		log.Printf("Failed to query database: %v", err)
-		return
+	// a retry that still had stints to close means the end was not announced yet
+	if ending || closed > 0 {
+		emitMatchEvent(MatchEvent{Type: "end", MatchID: matchID, Minute: finalMinute, Period: finalPeriod})
 	}
-	homeTeamScoreSummary, err1 := GetStatsSummary(matchID, "team", homeTeamID, "")
-	awayTeamScoreSummary, err2 := GetStatsSummary(matchID, "team", awayTeamID, "")
 
-	homePoints, ok := homeTeamScoreSummary["points"].(int)
-	if !ok {
-		homePoints = 0
+	return nil
+}
+
+// MatchStatInput is a single live stat submission, as posted to /api/match_stat
+// or sent over the scorekeeper WebSocket.
+type MatchStatInput struct {
+	MatchID  int    `json:"matchId"`
+	PlayerID int    `json:"playerId"`
+	TeamID   int    `json:"teamId,omitempty"` // only for team stats, which have no player
+	Minute   string `json:"minute"`
+	Period   int    `json:"period,omitempty"` // derived from the minute when omitted
+	Stat     string `json:"stat"`
+	EventID  string `json:"eventId,omitempty"` // client-chosen id, used as idempotency key when no Idempotency-Key header is sent
+
+	// Optional player linked to the play, credited with their side of it in the same submission
+	AssistPlayerID int `json:"assistPlayerId,omitempty"` // on a made 2pt/3pt
+	BlockPlayerID  int `json:"blockPlayerId,omitempty"`  // on a missed 2pt/3pt
+	StealPlayerID  int `json:"stealPlayerId,omitempty"`  // on a turnover
+}
+
+// matchStatError is a rejected stat submission along with the HTTP status describing it.
+type matchStatError struct {
+	Status  int
+	Message string
+}
+
+func (e *matchStatError) Error() string {
+	return e.Message
+}
+
+func AddMatchStat(w http.ResponseWriter, r *http.Request) {
+	var MatchStat MatchStatInput
+
+	if err := json.NewDecoder(r.Body).Decode(&MatchStat); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	awayPoints, ok := awayTeamScoreSummary["points"].(int)
-	if !ok {
-		awayPoints = 0
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		key = MatchStat.EventID
 	}
 
-	if err1 != nil || err2 != nil {
-		log.Printf("Failed to get team stat", err)
-	} else {
-		query := `
-			UPDATE matches
-			SET home_score = $1 , away_score = $2
-			WHERE match_id = $3`
-		_, err := db.PG.Exec(query, homePoints, awayPoints, matchID)
-		if err != nil {
-			return
-		}
+	events, replayed, err := recordMatchStatOnce(MatchStat, key, "")
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	if err != nil {
+		http.Error(w, err.Message, err.Status)
+		return
 	}
 
-	if successfullySynced {
-		pattern := fmt.Sprintf("match:%d:*", matchID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
 
-		keys, err := db.Redis.Keys(db.Ctx, pattern).Result()
-		if err != nil {
-			log.Printf("Failed to fetch keys with pattern %s: %v", pattern, err)
-			return
-		}
+// pushStatRecord appends a stat to a player's live list under a new match-unique event id.
+// It returns the event id along with the stored JSON.
+func pushStatRecord(matchID int, redisKey, minute string, period int, stat string) (string, string, error) {
+	record, err := newStatRecord(db.Redis, matchID, minute, period, stat)
+	if err != nil {
+		return "", "", err
+	}
 
-		if len(keys) == 0 {
-			log.Printf("No Redis keys found for match %d", matchID)
-			return
-		}
+	statJSON, err := appendStatRecord(matchID, redisKey, record)
+	if err != nil {
+		return "", "", err
+	}
 
-		if err := db.Redis.Del(db.Ctx, keys...).Err(); err != nil {
-			log.Printf("Failed to delete Redis keys for match %d: %v", matchID, err)
-		} else {
-			log.Printf("Successfully deleted Redis keys for match %d", matchID)
-		}
+	return record["id"], statJSON, nil
+}
+
+// newStatRecord builds a live stat record under a new match-unique event id
+func newStatRecord(rdb redis.Cmdable, matchID int, minute string, period int, stat string) (map[string]string, error) {
+	seq, err := rdb.Incr(db.Ctx, fmt.Sprintf("match:%d:stats:seq", matchID)).Result()
+	if err != nil {
+		return nil, err
 	}
+
+	return map[string]string{
+		"id":     strconv.FormatInt(seq, 10),
+		"minute": minute,
+		"period": strconv.Itoa(period),
+		"stat":   stat,
+	}, nil
 }
 
-func AddMatchStat(w http.ResponseWriter, r *http.Request) {
-	var MatchStat struct {
-		MatchID  int    `json:"matchId"`
-		PlayerID int    `json:"playerId"`
-		Minute   string `json:"minute"`
-		Stat     string `json:"stat"`
+// appendStatRecord appends a record to a player's live list and indexes its id,
+// so the event can later be amended or deleted. It returns the stored JSON.
+func appendStatRecord(matchID int, redisKey string, record map[string]string) (string, error) {
+	statJSON, err := json.Marshal(record)
+	if err != nil {
+		return "", err
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&MatchStat); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+	if matchStreamStore(matchID) {
+		// appended to the stream and projected to the list from there
+		if err := projectMatchStream(matchID); err != nil {
+			return "", err
+		}
+		teamID, playerID := statsKeyOwner(redisKey)
+		sw := statWrite{TeamID: teamID, PlayerID: playerID, RedisKey: redisKey, Record: record}
+		ev := scoreMatchEvent(db.Redis, sw.event(matchID, "")).addPoints(teamID, pointValues[record["stat"]])
+		if err := addStreamEvent(db.Redis, ev, string(statJSON)); err != nil {
+			return "", err
+		}
+		if err := projectMatchStream(matchID); err != nil {
+			return "", err
+		}
+		return string(statJSON), nil
 	}
 
-	if !isValidMinuteValue(MatchStat.Minute) {
-		http.Error(w, "Invalid minute value", http.StatusBadRequest)
-		return
+	_, err = db.Redis.TxPipelined(db.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(db.Ctx, redisKey, statJSON)
+		pipe.HSet(db.Ctx, statIndexKey(matchID), record["id"], redisKey)
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
 
-	if !slices.Contains(validStatsToAdd, MatchStat.Stat) {
-		http.Error(w, fmt.Sprintf("Invalid stat type. Available stats to add are: %v", validStatsToAdd), http.StatusBadRequest)
-		return
+	return string(statJSON), nil
+}
+
+func playerStatsKey(matchID, teamID, playerID int) string {
+	return fmt.Sprintf("match:%d:team:%d:player:%d:stats", matchID, teamID, playerID)
+}
+
+// statsKeyOwner returns the team and player of a live stats list, player 0 for a team's own list
+func statsKeyOwner(redisKey string) (int, int) {
+	// match:{matchId}:team:{teamId}:player:{playerId}:stats or match:{matchId}:team:{teamId}:stats
+	parts := strings.Split(redisKey, ":")
+	if len(parts) < 5 {
+		return 0, 0
 	}
+	teamID, _ := strconv.Atoi(parts[3])
+	var playerID int
+	if len(parts) == 7 {
+		playerID, _ = strconv.Atoi(parts[5])
+	}
+	return teamID, playerID
+}
 
+// Hash of event id -> player stats key holding the event
+func statIndexKey(matchID int) string {
+	return fmt.Sprintf("match:%d:stats:index", matchID)
+}
+
+// livePlayerStats returns the team, stats key and recorded stats of a player in a live match
+func livePlayerStats(rdb redis.Cmdable, matchID, playerID int) (int, string, []string, *matchStatError) {
 	// Redis key per player per match
-	teamIDStr, err := db.Redis.Get(db.Ctx, fmt.Sprintf("match:%d:player:%d:team", MatchStat.MatchID, MatchStat.PlayerID)).Result()
+	teamIDStr, err := rdb.Get(db.Ctx, fmt.Sprintf("match:%d:player:%d:team", matchID, playerID)).Result()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return 0, "", nil, &matchStatError{http.StatusBadRequest, err.Error()}
 	}
 	teamId, err := strconv.Atoi(teamIDStr)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return 0, "", nil, &matchStatError{http.StatusBadRequest, err.Error()}
 	}
 
-	redisKey := fmt.Sprintf("match:%d:team:%d:player:%d:stats", MatchStat.MatchID, teamId, MatchStat.PlayerID)
+	redisKey := fmt.Sprintf("match:%d:team:%d:player:%d:stats", matchID, teamId, playerID)
 
-	stats, err := db.Redis.LRange(db.Ctx, redisKey, 0, -1).Result()
+	stats, err := rdb.LRange(db.Ctx, redisKey, 0, -1).Result()
 	if err != nil {
-		return
+		return 0, "", nil, &matchStatError{http.StatusInternalServerError, "Failed to read player stats from Redis"}
 	}
 
-	if MatchStat.Stat != "in" {
-		// when player is out of game, the only stat can be recorded of him is "in"
+	return teamId, redisKey, stats, nil
+}
+
+// validateNewStat checks a stat can be added on top of the player's recorded stats
+func validateNewStat(stats []string, stat string) *matchStatError {
+	if stat != "in" && !canBeRecordedOffCourt(stat) {
+		// when player is out of game, the only stat can be recorded of them is "in"
 		if err := validatePlayerInPlay(stats); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			return &matchStatError{http.StatusBadRequest, err.Error()}
 		}
 	}
 
-	if hasReachedFoulLimit(stats) {
+	if reason := disqualificationReason(stats); reason != "" {
 		// no further stat should be inserted as player should be out
-		if MatchStat.Stat != "out" {
-			http.Error(w, "Player reached 6 fouls, ignoring this stat (unless it is out stat)", http.StatusForbidden)
-			return
+		if stat != "out" {
+			return &matchStatError{http.StatusForbidden, fmt.Sprintf("Player %s, ignoring this stat (unless it is out stat)", reason)}
 		}
 	}
 
-	if MatchStat.Stat == "in" || MatchStat.Stat == "out" {
-		if err := validateInOutSequence(stats, MatchStat.Stat); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+	if stat == "in" || stat == "out" {
+		if err := validateInOutSequence(stats, stat); err != nil {
+			return &matchStatError{http.StatusBadRequest, err.Error()}
 		}
 	}
 
-	statJSON, err := json.Marshal(map[string]string{
-		"minute": MatchStat.Minute,
-		"stat":   MatchStat.Stat,
-	})
-	if err != nil {
-		http.Error(w, "Failed to encode stat", http.StatusInternalServerError)
-		return
+	return nil
+}
+
+// recordMatchStat validates a stat submission against the player's live stats, appends it
+// to Redis and publishes it to the match event stream. When the submission links another
+// player to the play (assist, block or steal), the linked player's stat is validated and
+// recorded along with it. source identifies the submitting connection (empty for plain
+// HTTP) and is attached to the published events.
+func recordMatchStat(MatchStat MatchStatInput, source string) ([]MatchEvent, *matchStatError) {
+	if !isValidMinuteValue(MatchStat.Minute) {
+		return nil, &matchStatError{http.StatusBadRequest, "Invalid minute value"}
 	}
 
-	if err := db.Redis.RPush(db.Ctx, redisKey, statJSON).Err(); err != nil {
-		http.Error(w, "Failed to save stat to Redis", http.StatusInternalServerError)
-		return
+	// no play happens while a match is paused, substitutions and corrections still can
+	if isPausedMatch(MatchStat.MatchID) {
+		return nil, &matchStatError{http.StatusConflict, "Match is paused"}
 	}
 
-	// player is out
-	if hasReachedFoulLimit(stats) {
-		statJSON, _ := json.Marshal(map[string]string{
-			"minute": MatchStat.Minute,
-			"stat":   "out",
-		})
-		db.Redis.RPush(db.Ctx, redisKey, statJSON)
+	if !slices.Contains(validStatsToAdd, MatchStat.Stat) && !slices.Contains(validTeamStatsToAdd, MatchStat.Stat) {
+		return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Invalid stat type. Available stats to add are: %v, and for a team: %v", validStatsToAdd, validTeamStatsToAdd)}
 	}
 
-	w.WriteHeader(http.StatusOK)
-}
+	MatchStat.Stat = recordedStat(MatchStat.Stat)
 
-func GetMatchStats(w http.ResponseWriter, r *http.Request) {
-	keys, err := db.Redis.Keys(db.Ctx, "match:*:team:*:player:*:stats").Result()
+	period, err := resolveEventPeriod(MatchStat.MatchID, MatchStat.Minute, MatchStat.Period)
 	if err != nil {
-		http.Error(w, "Failed to fetch match keys", http.StatusInternalServerError)
-		return
+		return nil, &matchStatError{http.StatusBadRequest, err.Error()}
 	}
 
-	matchSet := make(map[string]bool)
+	if slices.Contains(validTeamStatsToAdd, MatchStat.Stat) {
+		return recordTeamStat(MatchStat, period, source)
+	}
 
-	for _, key := range keys {
-		parts := strings.Split(key, ":")
-		if len(parts) >= 2 {
-			matchSet[parts[1]] = true
-		}
+	linked, statErr := MatchStat.linkedPlay()
+	if statErr != nil {
+		return nil, statErr
 	}
 
-	var matches []int
-	for matchId := range matchSet {
-		id, err := strconv.Atoi(matchId)
-		if err == nil {
-			matches = append(matches, id)
+	keys, err := matchStatsKeys(MatchStat.MatchID)
+	if err != nil {
+		return nil, &matchStatError{http.StatusInternalServerError, "Failed to read match roster from Redis"}
+	}
+
+	writes, statErr := runStatTx(MatchStat.MatchID, source, keys, func(tx *redis.Tx) ([]statWrite, *matchStatError) {
+		teamId, redisKey, stats, statErr := livePlayerStats(tx, MatchStat.MatchID, MatchStat.PlayerID)
+		if statErr != nil {
+			return nil, statErr
+		}
+
+		if statErr := validateNewStat(stats, MatchStat.Stat); statErr != nil {
+			return nil, statErr
+		}
+
+		if MatchStat.Stat == "in" || MatchStat.Stat == "out" {
+			if statErr := validateSingleInOut(tx, MatchStat.MatchID, teamId, MatchStat.Stat); statErr != nil {
+				return nil, statErr
+			}
+		}
+
+		var linkedTeamID int
+		var linkedKey string
+		if linked != nil {
+			var linkedStats []string
+			linkedTeamID, linkedKey, linkedStats, statErr = livePlayerStats(tx, MatchStat.MatchID, linked.PlayerID)
+			if statErr != nil {
+				return nil, statErr
+			}
+
+			if linked.Teammate != (linkedTeamID == teamId) {
+				relation := "an opponent"
+				if linked.Teammate {
+					relation = "a teammate"
+				}
+				return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Player %d must be %s of player %d to be credited with %s", linked.PlayerID, relation, MatchStat.PlayerID, linked.Stat)}
+			}
+
+			if statErr := validateNewStat(linkedStats, linked.Stat); statErr != nil {
+				return nil, &matchStatError{statErr.Status, fmt.Sprintf("Player %d: %s", linked.PlayerID, statErr.Message)}
+			}
+		}
+
+		record, err := newStatRecord(tx, MatchStat.MatchID, MatchStat.Minute, period, MatchStat.Stat)
+		if err != nil {
+			return nil, &matchStatError{http.StatusInternalServerError, "Failed to save stat to Redis"}
+		}
+		writes := []statWrite{{teamId, MatchStat.PlayerID, redisKey, record}}
+
+		if linked != nil {
+			linkedRecord, err := newStatRecord(tx, MatchStat.MatchID, MatchStat.Minute, period, linked.Stat)
+			if err != nil {
+				return nil, &matchStatError{http.StatusInternalServerError, "Failed to save stat to Redis"}
+			}
+			linkRecords(record, MatchStat.PlayerID, linkedRecord, linked.PlayerID)
+			writes = append(writes, statWrite{linkedTeamID, linked.PlayerID, linkedKey, linkedRecord})
+		}
+
+		// player is out once this stat was their sixth foul or got them ejected, and gets
+		// replaced from the bench, all in the same transaction as the stat itself
+		statJSON, err := json.Marshal(record)
+		if err != nil {
+			return nil, &matchStatError{http.StatusInternalServerError, "Failed to encode stat"}
 		}
+		if validatePlayerInPlay(slices.Clone(stats)) == nil && !isDisqualified(stats) && isDisqualified(append(stats, string(statJSON))) {
+			outRecord, err := newStatRecord(tx, MatchStat.MatchID, MatchStat.Minute, period, "out")
+			if err != nil {
+				return nil, &matchStatError{http.StatusInternalServerError, "Failed to save stat to Redis"}
+			}
+			writes = append(writes, statWrite{teamId, MatchStat.PlayerID, redisKey, outRecord})
+
+			sub, err := substituteFor(tx, MatchStat.MatchID, teamId, MatchStat.PlayerID, MatchStat.Minute, period)
+			if err != nil {
+				log.Printf("Failed to substitute disqualified player %d: %v", MatchStat.PlayerID, err)
+			} else if sub != nil {
+				writes = append(writes, *sub)
+			}
+		}
+
+		return writes, nil
+	})
+	if statErr != nil {
+		return nil, statErr
+	}
+
+	if err := advanceMatchPeriod(MatchStat.MatchID, period); err != nil {
+		log.Printf("Failed to advance match %d to %s: %v", MatchStat.MatchID, periodLabel(period), err)
+	}
+
+	var events []MatchEvent
+	for _, sw := range writes {
+		events = append(events, announceMatchEvent(sw.event(MatchStat.MatchID, source)))
+	}
+
+	return events, nil
+}
+
+func GetMatchStats(w http.ResponseWriter, r *http.Request) {
+	matches, err := activeMatches()
+	if err != nil {
+		http.Error(w, "Failed to fetch active matches", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -440,20 +645,6 @@ func validatePlayerInPlay(stats []string) error {
 	return fmt.Errorf("player is out, can't add stat")
 }
 
-func hasReachedFoulLimit(stats []string) bool {
-	foulCount := 0
-	for _, item := range stats {
-		var record map[string]string
-		if err := json.Unmarshal([]byte(item), &record); err == nil {
-			if record["stat"] == "fouls" {
-				foulCount++
-			}
-		}
-	}
-
-	return foulCount >= 6
-}
-
 func validateInOutSequence(stats []string, newStat string) error {
 	stats = sortStatsByMinute(stats)
 
@@ -505,11 +696,11 @@ func GetStatsSummary(matchID int, entity string, entityID int, rawQuery string)
 	var err error
 
 	if entity == "team" {
-		pattern := fmt.Sprintf("match:%d:team:%d:player:*:stats", matchID, entityID)
-		keys, err := db.Redis.Keys(db.Ctx, pattern).Result()
+		keys, err := teamPlayerStatsKeys(matchID, entityID)
 		if err != nil {
-			return nil, fmt.Errorf("error fetching keys")
+			return nil, fmt.Errorf("error fetching roster")
 		}
+		keys = append(keys, teamStatsKey(matchID, entityID))
 		for _, key := range keys {
 			vals, err := db.Redis.LRange(db.Ctx, key, 0, -1).Result()
 			if err == nil {
@@ -534,7 +725,10 @@ func GetStatsSummary(matchID int, entity string, entityID int, rawQuery string)
 		return nil, fmt.Errorf("invalid entity type")
 	}
 
-	stats = sortStatsByMinute(stats)
+	// a player's list projected from a match stream is in minute order already
+	if entity == "team" || !matchStreamStore(matchID) {
+		stats = sortStatsByMinute(stats)
+	}
 
 	requestedStats, err := parseRequestedStats(rawQuery)
 	if err != nil {
@@ -552,8 +746,12 @@ func GetStatsSummary(matchID int, entity string, entityID int, rawQuery string)
 		parsedStats = append(parsedStats, record)
 	}
 
+	counts := make(map[string]int)
+
 	for _, record := range parsedStats {
-		stat := record["stat"]
+		// live lists of matches started before the split may hold plain "rebounds"
+		stat := recordedStat(record["stat"])
+		counts[stat]++
 		if requestedStats[stat] {
 			if _, exists := statSums[stat]; !exists {
 				statSums[stat] = 0
@@ -594,12 +792,75 @@ func GetStatsSummary(matchID int, entity string, entityID int, rawQuery string)
 		statSums["in"] = (inTime != "")
 	}
 
+	if requestedStats["rebounds"] {
+		total := 0
+		for _, stat := range reboundStats {
+			total += counts[stat]
+		}
+		if total > 0 {
+			statSums["rebounds"] = total
+		}
+	}
+
+	for stat, value := range shootingSplits(counts) {
+		if requestedStats[stat] {
+			statSums[stat] = value
+		}
+	}
+
+	// team fouls only make sense for a team
+	if entity == "team" && slices.ContainsFunc(teamFoulStats, func(stat string) bool { return requestedStats[stat] }) {
+		teamFouls, err := teamFoulSummary(matchID, entityID)
+		if err != nil {
+			return nil, err
+		}
+		for stat, value := range teamFouls {
+			if requestedStats[stat] {
+				statSums[stat] = value
+			}
+		}
+	}
+
+	// +/- needs the events of both teams, in time order. Like the rest of the summary it is
+	// read from Redis, a finished match's +/- is in its box score.
+	if requestedStats["plus_minus"] {
+		records, err := liveMatchRecords(matchID)
+		if err != nil {
+			return nil, err
+		}
+		sortMatchRecords(records)
+		statSums["plus_minus"] = entityPlusMinus(records, entity, entityID)
+	}
+
+	// possessions are estimated from the events of both teams, so only for a team
+	if entity == "team" && slices.ContainsFunc(tempoStats, func(stat string) bool { return requestedStats[stat] }) {
+		records, live, err := loadMatchRecords(matchID)
+		if err != nil {
+			return nil, err
+		}
+		var tempo teamTempo
+		tempo.addMatch(records, entityID, live)
+		tempo.finish(1)
+		for _, stat := range tempoStats {
+			if requestedStats[stat] {
+				statSums[stat] = tempo.value(stat)
+			}
+		}
+	}
+
+	if entity == "team" && requestedStats["timeouts_remaining"] {
+		remaining, err := timeoutsRemaining(matchID, entityID)
+		if err != nil {
+			return nil, err
+		}
+		statSums["timeouts_remaining"] = remaining
+	}
+
 	return statSums, nil
 }
 
 func lastMatchRecordedMinute(matchID int) string {
-	pattern := fmt.Sprintf("match:%d:team:*:player:*:stats", matchID)
-	keys, err := db.Redis.Keys(db.Ctx, pattern).Result()
+	keys, err := matchStatsKeys(matchID)
 	if err != nil || len(keys) == 0 {
 		return "0" // fallback default
 	}
@@ -655,7 +916,8 @@ func parseRequestedStats(query string) (map[string]bool, error) {
 }
 
 func sortStatsByMinute(stats []string) []string {
-	slices.SortFunc(stats, func(a, b string) int {
+	// stable, so events recorded at the same minute keep their recording order (e.g. a sixth foul and its "out")
+	slices.SortStableFunc(stats, func(a, b string) int {
 		var am, bm map[string]string
 
 		if err := json.Unmarshal([]byte(a), &am); err != nil {
@@ -713,16 +975,16 @@ func minuteDiff(fromStr, toStr string) string {
 }
 
 func parseMinute(minuteStr string) (int, int) {
-	parts := strings.Split(minuteStr, ".")
-	minutes, _ := strconv.Atoi(parts[0])
-	seconds, _ := strconv.Atoi(parts[1])
-	return minutes, seconds
+	totalSeconds := minuteToSeconds(minuteStr)
+	return totalSeconds / 60, totalSeconds % 60
 }
 
+// isValidMinuteValue checks the "MM.SS" format only; the upper bound depends on the
+// period being played and is enforced by resolveEventPeriod.
 func isValidMinuteValue(minute string) bool {
 	val, err := strconv.ParseFloat(minute, 64)
-	if err != nil {
+	if err != nil || val < 0.0 {
 		return false
 	}
-	return val >= 0.0 && val <= 48.0
+	return math.Round((val-math.Floor(val))*100) < 60
 }
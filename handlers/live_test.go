@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"skyhawk/db"
+	"testing"
+)
+
+func TestPlainReboundsRecordedAsUnknown(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+	playerID := testHomeTeam*10 + 1
+
+	for _, stat := range []string{"rebounds", "offensive_rebounds"} {
+		if _, statErr := recordMatchStat(MatchStatInput{MatchID: testMatchID, PlayerID: playerID, Minute: "03.00", Stat: stat}, ""); statErr != nil {
+			t.Fatalf("%s rejected: %v", stat, statErr)
+		}
+	}
+
+	stats, _ := db.Redis.LRange(db.Ctx, playerStatsKey(testMatchID, testHomeTeam, playerID), 0, -1).Result()
+	if unknown := countStat(stats, unknownReboundStat); unknown != 1 {
+		t.Errorf("%d rebounds of unknown type recorded, want 1", unknown)
+	}
+
+	summary, err := GetStatsSummary(testMatchID, "player", playerID, "rebounds")
+	if err != nil || summary["rebounds"] != 2 {
+		t.Errorf("rebounds total %v (%v), want 2", summary["rebounds"], err)
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Event types that can be filtered on besides single stats
+var playByPlayEventGroups = map[string][]string{
+	"scoring":       {"1pt", "2pt", "3pt"},
+	"shots":         {"1pt", "2pt", "3pt", "1pt_miss", "2pt_miss", "3pt_miss"},
+	"rebounds":      reboundStats,
+	"fouls":         append(slices.Clone(personalFoulStats), "technical_fouls", "bench_technical_fouls", "coach_technical_fouls"),
+	"substitutions": {"in", "out"},
+	"timeouts":      {"full_timeouts", "short_timeouts"},
+}
+
+type playByPlayEvent struct {
+	EventID          string `json:"eventId,omitempty"`
+	Period           int    `json:"period"`
+	PeriodLabel      string `json:"periodLabel"`
+	Minute           string `json:"minute"`
+	TeamID           int    `json:"teamId"`
+	TeamName         string `json:"teamName"`
+	PlayerID         int    `json:"playerId,omitempty"` // 0 for team stats
+	PlayerName       string `json:"playerName,omitempty"`
+	Stat             string `json:"stat"`
+	LinkedPlayerID   int    `json:"linkedPlayerId,omitempty"`
+	LinkedPlayerName string `json:"linkedPlayerName,omitempty"`
+	LinkedEventID    string `json:"linkedEventId,omitempty"`
+	HomeScore        int    `json:"homeScore"` // running score once the event was applied
+	AwayScore        int    `json:"awayScore"`
+}
+
+// GetPlayByPlay returns every event of a match, both teams merged, in time order.
+// Optional filters: period (number), teamId, and type (comma separated stats or event groups).
+func GetPlayByPlay(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var periodFilter, teamFilter int
+	if p := query.Get("period"); p != "" {
+		if periodFilter, err = strconv.Atoi(p); err != nil || periodFilter < 1 {
+			http.Error(w, "Invalid period", http.StatusBadRequest)
+			return
+		}
+	}
+	if t := query.Get("teamId"); t != "" {
+		if teamFilter, err = strconv.Atoi(t); err != nil {
+			http.Error(w, "Invalid teamId", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var typeFilter []string
+	if t := query.Get("type"); t != "" {
+		for _, eventType := range strings.Split(t, ",") {
+			eventType = strings.ToLower(strings.TrimSpace(eventType))
+			if group, ok := playByPlayEventGroups[eventType]; ok {
+				typeFilter = append(typeFilter, group...)
+			} else if slices.Contains(validStatsToAdd, eventType) || slices.Contains(validTeamStatsToAdd, eventType) || eventType == unknownReboundStat {
+				typeFilter = append(typeFilter, eventType)
+			} else {
+				http.Error(w, fmt.Sprintf("Invalid event type: %s", eventType), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	homeTeamID, awayTeamID, err := matchHomeAway(matchID)
+	if err != nil {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+
+	records, live, err := loadMatchRecords(matchID)
+	if err != nil {
+		log.Printf("Failed to load events of match %d: %v", matchID, err)
+		http.Error(w, "Failed to load match events", http.StatusInternalServerError)
+		return
+	}
+
+	teams, err := teamNames(homeTeamID, awayTeamID)
+	if err != nil {
+		log.Printf("Failed to read team names for match %d: %v", matchID, err)
+	}
+
+	var playerIDs []int
+	for _, record := range records {
+		playerIDs = append(playerIDs, record.PlayerID, record.LinkedPlayerID)
+	}
+	players, err := playerNames(playerIDs)
+	if err != nil {
+		log.Printf("Failed to read player names for match %d: %v", matchID, err)
+	}
+
+	events := []playByPlayEvent{}
+	homeScore, awayScore := 0, 0
+	for _, record := range records {
+		// the running score is kept over every event, filtered out or not
+		switch record.TeamID {
+		case homeTeamID:
+			homeScore += pointValues[record.Stat]
+		case awayTeamID:
+			awayScore += pointValues[record.Stat]
+		}
+
+		if periodFilter != 0 && record.Period != periodFilter {
+			continue
+		}
+		if teamFilter != 0 && record.TeamID != teamFilter {
+			continue
+		}
+		if typeFilter != nil && !slices.Contains(typeFilter, record.Stat) {
+			continue
+		}
+
+		events = append(events, playByPlayEvent{
+			EventID:          record.EventID,
+			Period:           record.Period,
+			PeriodLabel:      periodLabel(record.Period),
+			Minute:           record.Minute,
+			TeamID:           record.TeamID,
+			TeamName:         teams[record.TeamID],
+			PlayerID:         record.PlayerID,
+			PlayerName:       players[record.PlayerID],
+			Stat:             record.Stat,
+			LinkedPlayerID:   record.LinkedPlayerID,
+			LinkedPlayerName: players[record.LinkedPlayerID],
+			LinkedEventID:    record.LinkedEventID,
+			HomeScore:        homeScore,
+			AwayScore:        awayScore,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"matchId":  matchID,
+		"live":     live,
+		"homeTeam": map[string]interface{}{"teamId": homeTeamID, "teamName": teams[homeTeamID], "score": homeScore},
+		"awayTeam": map[string]interface{}{"teamId": awayTeamID, "teamName": teams[awayTeamID], "score": awayScore},
+		"events":   events,
+	})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// plusMinus replays the time-ordered records of a match and returns each player's +/-:
+// the points scored by their team minus the points scored by the opponent while they
+// were on court.
+func plusMinus(records []matchRecord) map[int]int {
+	onCourt := make(map[int]map[int]bool) // team -> players on court
+	result := make(map[int]int)
+
+	for _, record := range records {
+		switch record.Stat {
+		case "in":
+			if onCourt[record.TeamID] == nil {
+				onCourt[record.TeamID] = make(map[int]bool)
+			}
+			onCourt[record.TeamID][record.PlayerID] = true
+			if _, ok := result[record.PlayerID]; !ok {
+				result[record.PlayerID] = 0
+			}
+		case "out":
+			delete(onCourt[record.TeamID], record.PlayerID)
+		}
+
+		points := pointValues[record.Stat]
+		if points == 0 {
+			continue
+		}
+		for teamID, players := range onCourt {
+			for playerID := range players {
+				if teamID == record.TeamID {
+					result[playerID] += points
+				} else {
+					result[playerID] -= points
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// entityPlusMinus returns the +/- of a player, or the point differential of a team, over the
+// time-ordered records of a match
+func entityPlusMinus(records []matchRecord, entity string, entityID int) int {
+	if entity == "player" {
+		return plusMinus(records)[entityID]
+	}
+
+	differential := 0
+	for _, record := range records {
+		if record.TeamID == entityID {
+			differential += pointValues[record.Stat]
+		} else {
+			differential -= pointValues[record.Stat]
+		}
+	}
+	return differential
+}
+
+// seasonPlusMinus returns the total +/- of a player or team over the synced matches of a season,
+// replaying each match from 'matches_stats'
+func seasonPlusMinus(entity, idColumn, entityID, season string) (int, error) {
+	id, err := strconv.Atoi(entityID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s id %s", entity, entityID)
+	}
+
+	matchIDs, err := seasonMatches(idColumn, id, season)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, matchID := range matchIDs {
+		records, _, err := loadMatchRecords(matchID)
+		if err != nil {
+			return 0, err
+		}
+		total += entityPlusMinus(records, entity, id)
+	}
+	return total, nil
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import "testing"
+
+func TestEntityPlusMinus(t *testing.T) {
+	records := []matchRecord{
+		{TeamID: testHomeTeam, PlayerID: 101, Minute: "00.00", Stat: "in"},
+		{TeamID: testAwayTeam, PlayerID: 201, Minute: "00.00", Stat: "in"},
+		{TeamID: testHomeTeam, PlayerID: 101, Minute: "01.00", Stat: "3pt"},
+		{TeamID: testAwayTeam, PlayerID: 201, Minute: "02.00", Stat: "2pt"},
+		{TeamID: testHomeTeam, PlayerID: 101, Minute: "03.00", Stat: "out"},
+		{TeamID: testHomeTeam, PlayerID: 102, Minute: "03.00", Stat: "in"},
+		{TeamID: testAwayTeam, PlayerID: 201, Minute: "04.00", Stat: "3pt"},
+		{TeamID: testAwayTeam, Minute: "04.30", Stat: "full_timeouts"},
+	}
+
+	for _, tc := range []struct {
+		entity   string
+		entityID int
+		want     int
+	}{
+		{"player", 101, 1},
+		{"player", 102, -3},
+		{"player", 201, 2},
+		{"player", 999, 0},
+		{"team", testHomeTeam, -2},
+		{"team", testAwayTeam, 2},
+	} {
+		if got := entityPlusMinus(records, tc.entity, tc.entityID); got != tc.want {
+			t.Errorf("%s %d: +/- is %d, want %d", tc.entity, tc.entityID, got, tc.want)
+		}
+	}
+}
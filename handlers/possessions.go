@@ -0,0 +1,114 @@
+package handlers
+
+import "math"
+
+// Possessions are estimated from the box score, as the common
+// FGA + 0.44 * FTA - OREB + TOV: a possession ends with a shot that is not rebounded by the
+// offense, a trip to the line (0.44 accounts for and-ones and technicals) or a turnover.
+const freeThrowPossessionFactor = 0.44
+
+// possessionCounts are the events of one side that use up its possessions, and its points
+type possessionCounts struct {
+	FGA    int
+	FTA    int
+	OREB   int
+	TOV    int
+	Points int
+}
+
+func (c *possessionCounts) add(stat string) {
+	c.Points += pointValues[stat]
+	switch stat {
+	case "2pt", "2pt_miss", "3pt", "3pt_miss":
+		c.FGA++
+	case "1pt", "1pt_miss":
+		c.FTA++
+	case "offensive_rebounds":
+		c.OREB++
+	case "turnovers":
+		c.TOV++
+	}
+}
+
+func (c possessionCounts) possessions() float64 {
+	return math.Max(0, float64(c.FGA)+freeThrowPossessionFactor*float64(c.FTA)-float64(c.OREB)+float64(c.TOV))
+}
+
+// rating returns points per 100 possessions, 0 without possessions
+func rating(points int, possessions float64) float64 {
+	if possessions == 0 {
+		return 0
+	}
+	return roundTenth(100 * float64(points) / possessions)
+}
+
+func roundTenth(value float64) float64 {
+	return math.Round(value*10) / 10
+}
+
+// tempoStats are a team's tempo-free stats in a match summary, and their season averages
+var tempoStats = []string{"possessions", "pace", "offensive_rating", "defensive_rating"}
+
+// teamTempo is a team's possessions and pace over one or more matches, and its points per
+// 100 possessions scored (offensive rating) and allowed (defensive rating)
+type teamTempo struct {
+	Possessions     float64 `json:"possessions"`
+	Pace            float64 `json:"pace"` // possessions per 48 minutes
+	OffensiveRating float64 `json:"offensive_rating"`
+	DefensiveRating float64 `json:"defensive_rating"`
+
+	offense possessionCounts
+	defense possessionCounts
+	seconds int // of match time
+}
+
+// addMatch counts the time-ordered records of a match into the tempo of teamID. A live match
+// counts until its latest event, an ended one until the end of regulation or of its last overtime.
+func (t *teamTempo) addMatch(records []matchRecord, teamID int, live bool) {
+	lastPeriod := 1
+	lastSecond := 0
+	for _, record := range records {
+		lastPeriod = max(lastPeriod, record.Period)
+		lastSecond = max(lastSecond, minuteToSeconds(record.Minute))
+		if record.TeamID == teamID {
+			t.offense.add(record.Stat)
+		} else {
+			t.defense.add(record.Stat)
+		}
+	}
+
+	if live {
+		t.seconds += lastSecond
+	} else {
+		t.seconds += periodEndSeconds(max(lastPeriod, regulationPeriods))
+	}
+}
+
+// finish derives possessions, pace and ratings from what was counted, over the given number of
+// matches. Both sides have about as many possessions, so the two estimates are averaged.
+func (t *teamTempo) finish(matches int) {
+	possessions := (t.offense.possessions() + t.defense.possessions()) / 2
+	t.OffensiveRating = rating(t.offense.Points, possessions)
+	t.DefensiveRating = rating(t.defense.Points, possessions)
+	if matches > 0 {
+		t.Possessions = roundTenth(possessions / float64(matches))
+	}
+	if t.seconds > 0 {
+		t.Pace = roundTenth(possessions * float64(regulationPeriods*quarterMinutes*60) / float64(t.seconds))
+	}
+}
+
+// value returns one of tempoStats
+func (t teamTempo) value(stat string) float64 {
+	switch stat {
+	case "possessions":
+		return t.Possessions
+	case "pace":
+		return t.Pace
+	case "offensive_rating":
+		return t.OffensiveRating
+	case "defensive_rating":
+		return t.DefensiveRating
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import "testing"
+
+func TestTeamTempo(t *testing.T) {
+	records := []matchRecord{
+		// home: 3 FGA + 0.44 * 2 FTA - 1 OREB + 1 TOV = 3.88 possessions, 7 points
+		{TeamID: testHomeTeam, PlayerID: 101, Minute: "01.00", Period: 1, Stat: "2pt_miss"},
+		{TeamID: testHomeTeam, PlayerID: 102, Minute: "01.05", Period: 1, Stat: "offensive_rebounds"},
+		{TeamID: testHomeTeam, PlayerID: 102, Minute: "01.10", Period: 1, Stat: "2pt"},
+		{TeamID: testHomeTeam, PlayerID: 101, Minute: "02.00", Period: 1, Stat: "3pt"},
+		{TeamID: testHomeTeam, PlayerID: 103, Minute: "03.00", Period: 1, Stat: "1pt"},
+		{TeamID: testHomeTeam, PlayerID: 103, Minute: "03.00", Period: 1, Stat: "1pt"},
+		{TeamID: testHomeTeam, PlayerID: 104, Minute: "04.00", Period: 1, Stat: "turnovers"},
+		// away: 4 FGA - 0 OREB + 0 TOV = 4 possessions, 4 points
+		{TeamID: testAwayTeam, PlayerID: 201, Minute: "01.30", Period: 1, Stat: "2pt"},
+		{TeamID: testAwayTeam, PlayerID: 201, Minute: "02.30", Period: 1, Stat: "2pt"},
+		{TeamID: testAwayTeam, PlayerID: 202, Minute: "03.30", Period: 1, Stat: "3pt_miss"},
+		{TeamID: testAwayTeam, PlayerID: 202, Minute: "04.30", Period: 1, Stat: "3pt_miss"},
+		{TeamID: testAwayTeam, Minute: "05.00", Period: 1, Stat: "full_timeouts"},
+	}
+
+	// live, 5 minutes played: 3.94 possessions, 37.8 per 48 minutes
+	var live teamTempo
+	live.addMatch(records, testHomeTeam, true)
+	live.finish(1)
+	if want := (teamTempo{Possessions: 3.9, Pace: 37.8, OffensiveRating: 177.7, DefensiveRating: 101.5}); live.Possessions != want.Possessions ||
+		live.Pace != want.Pace || live.OffensiveRating != want.OffensiveRating || live.DefensiveRating != want.DefensiveRating {
+		t.Errorf("live tempo %+v, want %+v", live, want)
+	}
+
+	// the same events as two ended matches of a full 48 minutes each
+	var season teamTempo
+	season.addMatch(records, testAwayTeam, false)
+	season.addMatch(records, testAwayTeam, false)
+	season.finish(2)
+	if season.Possessions != 3.9 || season.Pace != 3.9 || season.OffensiveRating != 101.5 || season.DefensiveRating != 177.7 {
+		t.Errorf("season tempo %+v", season)
+	}
+}
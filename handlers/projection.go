@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"skyhawk/db"
+	"slices"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Stream projection.
+// With the streams live store a change is only appended to the match stream. The players' and
+// teams' lists and the event index are a projection of the stream: its "stat", "amend" and
+// "delete" entries applied in order, each list kept in minute order. match:{id}:stream:projected
+// holds the id of the last entry applied. Submissions validate against the projection once it
+// is caught up with the stream, and project their own entries once appended, so the lists read
+// afterwards include them. The feeds relay catches up whatever a stopped instance left behind.
+const streamProjectionBatch = 100
+
+func matchProjectedKey(matchID int) string {
+	return fmt.Sprintf("match:%d:stream:projected", matchID)
+}
+
+// projectMatchStream applies the entries of a match stream not projected yet to its lists.
+// Nothing happens once the match is cleared from Redis, so a stream kept after the sync doesn't
+// bring the lists back.
+func projectMatchStream(matchID int) error {
+	for attempt := 0; attempt < maxStatTxAttempts; {
+		caughtUp := false
+
+		err := db.Redis.Watch(db.Ctx, func(tx *redis.Tx) error {
+			store, err := tx.Get(db.Ctx, matchLiveStoreKey(matchID)).Result()
+			if errors.Is(err, redis.Nil) || (err == nil && store != LiveStoreStreams) {
+				caughtUp = true
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			start := "-"
+			projected, err := tx.Get(db.Ctx, matchProjectedKey(matchID)).Result()
+			if err == nil {
+				start = "(" + projected
+			} else if !errors.Is(err, redis.Nil) {
+				return err
+			}
+
+			messages, err := tx.XRangeN(db.Ctx, matchStreamKey(matchID), start, "+", streamProjectionBatch).Result()
+			if err != nil {
+				return err
+			}
+			if len(messages) == 0 {
+				caughtUp = true
+				return nil
+			}
+
+			projection := streamProjection{matchID: matchID, lists: make(statListEdits), index: make(map[string]string)}
+			for _, msg := range messages {
+				if err := projection.apply(tx, msg); err != nil {
+					return err
+				}
+			}
+
+			_, err = tx.TxPipelined(db.Ctx, func(pipe redis.Pipeliner) error {
+				projection.write(pipe)
+				pipe.Set(db.Ctx, matchProjectedKey(matchID), messages[len(messages)-1].ID, 0)
+				return nil
+			})
+			return err
+		}, matchLiveStoreKey(matchID), matchProjectedKey(matchID))
+
+		if errors.Is(err, redis.TxFailedErr) {
+			// another instance projected the same entries
+			attempt++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to project the stream of match %d: %v", matchID, err)
+		}
+		if caughtUp {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to project the stream of match %d: too many concurrent projections", matchID)
+}
+
+// projectionBehind tells, through tx, whether a match stream has entries not projected yet
+func projectionBehind(tx *redis.Tx, matchID int) (bool, error) {
+	last, err := tx.XRevRangeN(db.Ctx, matchStreamKey(matchID), "+", "-", 1).Result()
+	if err != nil || len(last) == 0 {
+		return false, err
+	}
+	projected, err := tx.Get(db.Ctx, matchProjectedKey(matchID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return true, nil
+	}
+	return projected != last[0].ID, err
+}
+
+// streamProjection is a batch of stream entries applied to the lists they change
+type streamProjection struct {
+	matchID int
+	lists   statListEdits
+	index   map[string]string // event id -> list holding it, "" once deleted
+}
+
+func (p *streamProjection) apply(rdb redis.Cmdable, msg redis.XMessage) error {
+	ev, err := streamMessageEvent(msg)
+	if err != nil {
+		log.Printf("Skipping stream entry of match %d: %v", p.matchID, err)
+		return nil
+	}
+	record, _ := msg.Values["record"].(string)
+
+	switch ev.Type {
+	case "stat":
+		return p.insert(rdb, ev, record)
+	case "amend":
+		if err := p.remove(rdb, ev.EventID); err != nil {
+			return err
+		}
+		return p.insert(rdb, ev, record)
+	case "delete":
+		return p.remove(rdb, ev.EventID)
+	}
+	return nil
+}
+
+// insert adds a record to the list of its player or team, after every record at the same
+// minute or earlier
+func (p *streamProjection) insert(rdb redis.Cmdable, ev MatchEvent, record string) error {
+	key := teamStatsKey(p.matchID, ev.TeamID)
+	if ev.PlayerID != 0 {
+		key = playerStatsKey(p.matchID, ev.TeamID, ev.PlayerID)
+	}
+
+	stats, statErr := p.lists.list(rdb, key)
+	if statErr != nil {
+		return errors.New(statErr.Message)
+	}
+
+	seconds := minuteToSeconds(ev.Minute)
+	at := len(stats)
+	for at > 0 && minuteToSeconds(recordMinute(stats[at-1])) > seconds {
+		at--
+	}
+	p.lists[key] = slices.Insert(slices.Clone(stats), at, record)
+	p.index[ev.EventID] = key
+	return nil
+}
+
+// remove takes the record of an event out of the list holding it
+func (p *streamProjection) remove(rdb redis.Cmdable, eventID string) error {
+	key, ok := p.index[eventID]
+	if !ok {
+		var err error
+		key, err = rdb.HGet(db.Ctx, statIndexKey(p.matchID), eventID).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if key == "" {
+		return nil
+	}
+
+	stats, statErr := p.lists.list(rdb, key)
+	if statErr != nil {
+		return errors.New(statErr.Message)
+	}
+	p.lists[key] = slices.DeleteFunc(slices.Clone(stats), func(raw string) bool {
+		var record map[string]string
+		return json.Unmarshal([]byte(raw), &record) == nil && record["id"] == eventID
+	})
+	p.index[eventID] = ""
+	return nil
+}
+
+// write queues the changed lists and index entries
+func (p *streamProjection) write(pipe redis.Pipeliner) {
+	for key, stats := range p.lists {
+		pipe.Del(db.Ctx, key)
+		if len(stats) > 0 {
+			pipe.RPush(db.Ctx, key, stats)
+		}
+	}
+	for eventID, key := range p.index {
+		if key == "" {
+			pipe.HDel(db.Ctx, statIndexKey(p.matchID), eventID)
+		} else {
+			pipe.HSet(db.Ctx, statIndexKey(p.matchID), eventID, key)
+		}
+	}
+}
+
+func recordMinute(raw string) string {
+	var record map[string]string
+	json.Unmarshal([]byte(raw), &record)
+	return record["minute"]
+}
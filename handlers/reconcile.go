@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// Startup reconciliation.
+// A restart can leave a match half-way between Redis and Postgres, e.g. ended but not synced.
+// On boot every match marked started in Redis is compared with its row in 'matches' and its
+// rows in 'matches_stats', and resumed, finished or flagged for a person to look at.
+// The report of the last run is kept in Redis for the admin API.
+const reconciliationReportKey = "reconciliation:last"
+
+const (
+	reconcileResumed   = "resumed"   // still being played, kept live
+	reconcileFinished  = "finished"  // ended before the restart, synced now
+	reconcileQueued    = "queued"    // ended before the restart, sync failed and was queued
+	reconcileCleaned   = "cleaned"   // already synced, leftover live data removed
+	reconcileDiscarded = "discarded" // cancelled, leftover live data removed
+	reconcileFlagged   = "flagged"   // left as is, needs a look
+)
+
+type reconciledMatch struct {
+	MatchID      int    `json:"matchId"`
+	InRedis      bool   `json:"inRedis"`
+	Status       string `json:"status,omitempty"` // in 'matches', before reconciliation
+	StoredEvents int    `json:"storedEvents"`     // rows in 'matches_stats'
+	Action       string `json:"action"`
+	Detail       string `json:"detail,omitempty"`
+}
+
+type reconciliationReport struct {
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt time.Time         `json:"finishedAt"`
+	Matches    []reconciledMatch `json:"matches"`
+}
+
+// startedMatches returns the matches marked started in Redis. Besides the active matches index,
+// the started keys themselves are scanned once, for matches started before the index existed.
+func startedMatches() ([]int, error) {
+	matchIDs, err := activeMatches()
+	if err != nil {
+		return nil, err
+	}
+
+	iter := db.Redis.Scan(db.Ctx, 0, "match:*:started", 100).Iterator()
+	for iter.Next(db.Ctx) {
+		// match:{matchId}:started
+		parts := strings.Split(iter.Val(), ":")
+		if len(parts) != 3 {
+			continue
+		}
+		if matchID, err := strconv.Atoi(parts[1]); err == nil && !slices.Contains(matchIDs, matchID) {
+			matchIDs = append(matchIDs, matchID)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	var started []int
+	for _, matchID := range matchIDs {
+		if isLiveMatch(matchID) {
+			started = append(started, matchID)
+		}
+	}
+	slices.Sort(started)
+	return started, nil
+}
+
+// ReconcileLiveMatches brings every match left in Redis in line with Postgres, and the other way
+// around, then logs and stores the report
+func ReconcileLiveMatches() {
+	report := reconciliationReport{StartedAt: time.Now(), Matches: []reconciledMatch{}}
+
+	matchIDs, err := startedMatches()
+	if err != nil {
+		log.Printf("[Reconciliation] Failed to read started matches from Redis: %v", err)
+		return
+	}
+	for _, matchID := range matchIDs {
+		report.Matches = append(report.Matches, reconcileLiveMatch(matchID))
+	}
+
+	// matches Postgres has in play, with nothing left in Redis to finish them from
+	rows, err := db.PG.Query(`
+		SELECT m.match_id, m.status, COUNT(ms.match_id)
+		FROM matches m LEFT JOIN matches_stats ms ON ms.match_id = m.match_id
+		WHERE m.status = ANY($1)
+		GROUP BY m.match_id, m.status
+	`, pq.Array([]string{matchLive, matchPaused, matchFinal}))
+	if err != nil {
+		log.Printf("[Reconciliation] Failed to read matches in play from Postgres: %v", err)
+	} else {
+		for rows.Next() {
+			entry := reconciledMatch{Action: reconcileFlagged}
+			if err := rows.Scan(&entry.MatchID, &entry.Status, &entry.StoredEvents); err != nil {
+				log.Printf("[Reconciliation] Failed to read match: %v", err)
+				continue
+			}
+			if slices.Contains(matchIDs, entry.MatchID) {
+				continue
+			}
+			entry.Detail = fmt.Sprintf("%s in Postgres, but has no live data in Redis", entry.Status)
+			report.Matches = append(report.Matches, entry)
+		}
+		rows.Close()
+	}
+
+	report.FinishedAt = time.Now()
+
+	for _, entry := range report.Matches {
+		log.Printf("[Reconciliation] Match %d (%s, %d stored events): %s %s", entry.MatchID, entry.Status, entry.StoredEvents, entry.Action, entry.Detail)
+	}
+	log.Printf("[Reconciliation] %d matches reconciled", len(report.Matches))
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("[Reconciliation] Failed to encode report: %v", err)
+		return
+	}
+	if err := db.Redis.Set(db.Ctx, reconciliationReportKey, reportJSON, 0).Err(); err != nil {
+		log.Printf("[Reconciliation] Failed to save report: %v", err)
+	}
+}
+
+// reconcileLiveMatch resumes, finishes or flags a match marked started in Redis
+func reconcileLiveMatch(matchID int) reconciledMatch {
+	entry := reconciledMatch{MatchID: matchID, InRedis: true}
+
+	var homeTeamID, awayTeamID int
+	err := db.PG.QueryRow(`
+		SELECT m.status, m.home_team, m.away_team, (SELECT COUNT(*) FROM matches_stats ms WHERE ms.match_id = m.match_id)
+		FROM matches m WHERE m.match_id = $1
+	`, matchID).Scan(&entry.Status, &homeTeamID, &awayTeamID, &entry.StoredEvents)
+	if errors.Is(err, sql.ErrNoRows) {
+		entry.Action = reconcileFlagged
+		entry.Detail = "live in Redis, but not in Postgres"
+		return entry
+	}
+	if err != nil {
+		entry.Action = reconcileFlagged
+		entry.Detail = fmt.Sprintf("failed to read match from Postgres: %v", err)
+		return entry
+	}
+
+	// a match still to be played or synced is read through its index
+	if entry.Status != matchSynced && entry.Status != matchCancelled {
+		indexed, err := rebuildMatchIndex(matchID, homeTeamID, awayTeamID)
+		if err != nil {
+			entry.Action = reconcileFlagged
+			entry.Detail = fmt.Sprintf("failed to rebuild its index: %v", err)
+			return entry
+		}
+		if indexed > 0 {
+			entry.Detail = fmt.Sprintf("index rebuilt for %d players", indexed)
+		}
+	}
+
+	switch entry.Status {
+	case matchScheduled, matchLive, matchPaused:
+		if entry.StoredEvents > 0 {
+			// an earlier sync stored part of the match, before syncs were transactional
+			entry.Action = reconcileFlagged
+			entry.Detail = "still live, but already has stats in Postgres"
+			return entry
+		}
+		if err := resumeLiveMatch(matchID, entry.Status); err != nil {
+			entry.Action = reconcileFlagged
+			entry.Detail = fmt.Sprintf("failed to resume: %v", err)
+			return entry
+		}
+		entry.Action = reconcileResumed
+		if entry.Status == matchScheduled {
+			if entry.Detail != "" {
+				entry.Detail += ", "
+			}
+			entry.Detail += "started before match status was tracked, now live"
+		}
+
+	case matchFinal:
+		// ended, the restart came before its sync finished
+		if statErr := closeMatchStints(matchID, false); statErr != nil {
+			entry.Action = reconcileFlagged
+			entry.Detail = statErr.Message
+			return entry
+		}
+		if _, err := runMatchSync(matchID); err != nil {
+			entry.Action = reconcileQueued
+			entry.Detail = err.Error()
+			return entry
+		}
+		entry.Action = reconcileFinished
+
+	case matchSynced:
+		clearLiveMatch(matchID, nil)
+		entry.Action = reconcileCleaned
+
+	case matchCancelled:
+		if err := discardLiveMatch(matchID); err != nil {
+			entry.Action = reconcileFlagged
+			entry.Detail = fmt.Sprintf("failed to discard: %v", err)
+			return entry
+		}
+		entry.Action = reconcileDiscarded
+	}
+
+	return entry
+}
+
+// rebuildMatchIndex indexes the teams and rosters of a match started before they were kept in
+// Redis (see index.go), which would otherwise be ended and synced with none of its stats. The
+// players are found with a one-time SCAN of the match's stats lists. It returns how many players
+// were indexed, none when the match already has its index.
+func rebuildMatchIndex(matchID, homeTeamID, awayTeamID int) (int, error) {
+	home, away := matchTeams(matchID)
+	indexed := home == homeTeamID && away == awayTeamID
+	for _, teamID := range []int{homeTeamID, awayTeamID} {
+		if n, err := db.Redis.SCard(db.Ctx, matchRosterKey(matchID, teamID)).Result(); err != nil || n == 0 {
+			indexed = false
+		}
+	}
+	if indexed {
+		return 0, nil
+	}
+
+	players := make(map[int]int) // player -> team
+	iter := db.Redis.Scan(db.Ctx, 0, fmt.Sprintf("match:%d:team:*:player:*:stats", matchID), 100).Iterator()
+	for iter.Next(db.Ctx) {
+		teamID, playerID := statsKeyOwner(iter.Val())
+		if playerID == 0 {
+			continue
+		}
+		if teamID != homeTeamID && teamID != awayTeamID {
+			return 0, fmt.Errorf("player %d has stats for team %d, which is not playing the match", playerID, teamID)
+		}
+		players[playerID] = teamID
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+
+	_, err := db.Redis.TxPipelined(db.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(db.Ctx, fmt.Sprintf("match:%d:home_team", matchID), homeTeamID, 0)
+		pipe.Set(db.Ctx, fmt.Sprintf("match:%d:away_team", matchID), awayTeamID, 0)
+		for playerID, teamID := range players {
+			pipe.SAdd(db.Ctx, matchRosterKey(matchID, teamID), playerID)
+			pipe.Set(db.Ctx, fmt.Sprintf("match:%d:player:%d:team", matchID, playerID), teamID, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(players), nil
+}
+
+// resumeLiveMatch makes sure a match still being played is indexed as active, and that its
+// status in Postgres and its paused flag in Redis agree
+func resumeLiveMatch(matchID int, status string) error {
+	if status == matchScheduled {
+		if statErr := transitionMatchStatus(matchID, matchLive); statErr != nil {
+			return errors.New(statErr.Message)
+		}
+		status = matchLive
+	}
+
+	_, err := db.Redis.TxPipelined(db.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(db.Ctx, activeMatchesKey, matchID)
+		if status == matchPaused {
+			pipe.Set(db.Ctx, matchPausedKey(matchID), "true", 0)
+		} else {
+			pipe.Del(db.Ctx, matchPausedKey(matchID))
+		}
+		return nil
+	})
+	return err
+}
+
+// GetReconciliationReport returns the report of the last startup reconciliation
+func GetReconciliationReport(w http.ResponseWriter, r *http.Request) {
+	reportJSON, err := db.Redis.Get(db.Ctx, reconciliationReportKey).Result()
+	if errors.Is(err, redis.Nil) {
+		http.Error(w, "No reconciliation has run yet", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read reconciliation report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(reportJSON))
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"fmt"
+	"skyhawk/db"
+	"testing"
+)
+
+// A match started before the index keys only has its players' lists, which the rebuild indexes
+// so that the match is synced with its stats.
+func TestRebuildMatchIndexOfLegacyMatch(t *testing.T) {
+	startTestMatch(t, 5)
+	db.Redis.Del(db.Ctx,
+		fmt.Sprintf("match:%d:home_team", testMatchID),
+		fmt.Sprintf("match:%d:away_team", testMatchID),
+		matchRosterKey(testMatchID, testHomeTeam),
+		matchRosterKey(testMatchID, testAwayTeam),
+	)
+
+	indexed, err := rebuildMatchIndex(testMatchID, testHomeTeam, testAwayTeam)
+	if err != nil {
+		t.Fatalf("failed to rebuild index: %v", err)
+	}
+	if indexed != 10 {
+		t.Fatalf("expected the 10 players with stats to be indexed, got %d", indexed)
+	}
+	if home, away := matchTeams(testMatchID); home != testHomeTeam || away != testAwayTeam {
+		t.Fatalf("expected teams %d and %d, got %d and %d", testHomeTeam, testAwayTeam, home, away)
+	}
+	keys, err := matchStatsKeys(testMatchID)
+	if err != nil {
+		t.Fatalf("failed to read stats keys: %v", err)
+	}
+	if len(keys) < 10 {
+		t.Fatalf("expected the stats of 10 players, got %d keys", len(keys))
+	}
+
+	if indexed, err := rebuildMatchIndex(testMatchID, testHomeTeam, testAwayTeam); err != nil || indexed != 0 {
+		t.Fatalf("expected an indexed match to be left alone, got %d players, %v", indexed, err)
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"skyhawk/db"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// matchRecord is a single stat event of a match, read from the live Redis lists while the
+// match is being played or from 'matches_stats' once it was synced.
+// PlayerID is 0 for team stats such as timeouts.
+type matchRecord struct {
+	EventID        string
+	TeamID         int
+	PlayerID       int
+	Minute         string
+	Period         int
+	Stat           string
+	LinkedPlayerID int
+	LinkedEventID  string
+}
+
+func isLiveMatch(matchID int) bool {
+	started, _ := db.Redis.Get(db.Ctx, fmt.Sprintf("match:%d:started", matchID)).Result()
+	return started == "true"
+}
+
+// loadMatchRecords returns every stat event of a match in time order,
+// and whether they come from the live match
+func loadMatchRecords(matchID int) ([]matchRecord, bool, error) {
+	var records []matchRecord
+	var err error
+
+	live := isLiveMatch(matchID)
+	if live {
+		records, err = liveMatchRecords(matchID)
+	} else {
+		records, err = syncedMatchRecords(matchID)
+	}
+	if err != nil {
+		return nil, live, err
+	}
+
+	sortMatchRecords(records)
+	return records, live, nil
+}
+
+// sortMatchRecords puts the records of a match in time order
+func sortMatchRecords(records []matchRecord) {
+	// events at the same minute keep their recording order, e.g. a sixth foul and its "out"
+	slices.SortStableFunc(records, func(a, b matchRecord) int {
+		return cmp.Or(
+			cmp.Compare(minuteToSeconds(a.Minute), minuteToSeconds(b.Minute)),
+			cmp.Compare(a.Period, b.Period),
+			compareEventIDs(a.EventID, b.EventID),
+		)
+	})
+}
+
+func liveMatchRecords(matchID int) ([]matchRecord, error) {
+	if matchStreamStore(matchID) {
+		return streamMatchRecords(matchID)
+	}
+	return listMatchRecords(matchID)
+}
+
+// listMatchRecords returns the records of a live match from its players' and teams' lists
+func listMatchRecords(matchID int) ([]matchRecord, error) {
+	// players' lists and the teams' own lists
+	keys, err := matchStatsKeys(matchID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching roster")
+	}
+
+	var records []matchRecord
+	for _, key := range keys {
+		stats, err := db.Redis.LRange(db.Ctx, key, 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stats for key %s", key)
+		}
+
+		// match:{matchId}:team:{teamId}:player:{playerId}:stats or match:{matchId}:team:{teamId}:stats
+		parts := strings.Split(key, ":")
+		teamID, _ := strconv.Atoi(parts[3])
+		var playerID int
+		if len(parts) == 7 {
+			playerID, _ = strconv.Atoi(parts[5])
+		}
+
+		for _, item := range stats {
+			var record map[string]string
+			if err := json.Unmarshal([]byte(item), &record); err != nil {
+				continue
+			}
+
+			// live lists of matches started before the split may hold plain "rebounds"
+			stat := recordedStat(record["stat"])
+
+			records = append(records, matchRecord{
+				EventID:        record["id"],
+				TeamID:         teamID,
+				PlayerID:       playerID,
+				Minute:         record["minute"],
+				Period:         periodOfRecord(record),
+				Stat:           stat,
+				LinkedPlayerID: linkedPlayerOf(record),
+				LinkedEventID:  record["linked_event_id"],
+			})
+		}
+	}
+
+	return records, nil
+}
+
+func syncedMatchRecords(matchID int) ([]matchRecord, error) {
+	rows, err := db.PG.Query(`
+		SELECT event_id, team_id, player_id, minute, period, stat, linked_player_id, linked_event_id
+		FROM matches_stats
+		WHERE match_id = $1
+	`, matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []matchRecord
+	for rows.Next() {
+		var eventID, linkedEventID sql.NullString
+		var playerID, period, linkedPlayerID sql.NullInt64
+		var r matchRecord
+
+		if err := rows.Scan(&eventID, &r.TeamID, &playerID, &r.Minute, &period, &r.Stat, &linkedPlayerID, &linkedEventID); err != nil {
+			return nil, err
+		}
+
+		// the REAL column turns "12.30" into "12.3"
+		r.Minute = formatSeconds(minuteToSeconds(r.Minute))
+		r.EventID = eventID.String
+		r.PlayerID = int(playerID.Int64)
+		r.Period = int(period.Int64)
+		if r.Period == 0 {
+			r.Period = periodForMinute(r.Minute)
+		}
+		r.LinkedPlayerID = int(linkedPlayerID.Int64)
+		r.LinkedEventID = linkedEventID.String
+
+		records = append(records, r)
+	}
+
+	return records, rows.Err()
+}
+
+// compareEventIDs orders event ids by the match sequence they were taken from
+func compareEventIDs(a, b string) int {
+	ai, aErr := strconv.ParseInt(a, 10, 64)
+	bi, bErr := strconv.ParseInt(b, 10, 64)
+	if aErr != nil || bErr != nil {
+		return 0
+	}
+	return cmp.Compare(ai, bi)
+}
+
+// matchHomeAway returns the home and away teams of a match from 'matches'
+func matchHomeAway(matchID int) (int, int, error) {
+	var homeTeamID, awayTeamID int
+	err := db.PG.QueryRow(`
+		SELECT home_team, away_team FROM matches WHERE match_id = $1
+	`, matchID).Scan(&homeTeamID, &awayTeamID)
+	return homeTeamID, awayTeamID, err
+}
+
+// teamNames returns the names of the given teams
+func teamNames(teamIDs ...int) (map[int]string, error) {
+	names := make(map[int]string)
+	for _, teamID := range teamIDs {
+		var name string
+		if err := db.PG.QueryRow(`SELECT team_name FROM teams WHERE team_id = $1`, teamID).Scan(&name); err != nil {
+			return nil, err
+		}
+		names[teamID] = name
+	}
+	return names, nil
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+)
+
+// matchRoster is the players a team dresses for a match: the starting five and everyone
+// else available to come off the bench.
+type matchRoster struct {
+	Starters []int `json:"starters"`
+	Bench    []int `json:"bench"`
+}
+
+// UnmarshalJSON also accepts a plain list of player ids, the starters-only body
+// StartMatch took before rosters were registered.
+func (m *matchRoster) UnmarshalJSON(data []byte) error {
+	var starters []int
+	if err := json.Unmarshal(data, &starters); err == nil {
+		*m = matchRoster{Starters: starters}
+		return nil
+	}
+
+	type roster matchRoster
+	return json.Unmarshal(data, (*roster)(m))
+}
+
+func (m matchRoster) players() []int {
+	return append(slices.Clone(m.Starters), m.Bench...)
+}
+
+func matchRosterKey(matchID, teamID int) string {
+	return fmt.Sprintf("match:%d:team:%d:roster", matchID, teamID)
+}
+
+func matchStartersKey(matchID, teamID int) string {
+	return fmt.Sprintf("match:%d:team:%d:starters", matchID, teamID)
+}
+
+// validateMatchRoster checks a team's roster against its current players in 'player_team_history'
+func validateMatchRoster(teamID int, roster matchRoster) *matchStatError {
+	if len(roster.Starters) != playersOnCourt {
+		return &matchStatError{http.StatusBadRequest, fmt.Sprintf("Team %d must have exactly %d starters", teamID, playersOnCourt)}
+	}
+
+	rows, err := db.PG.Query(`
+		SELECT player_id FROM player_team_history
+		WHERE team_id = $1 AND end_date IS NULL
+	`, teamID)
+	if err != nil {
+		return &matchStatError{http.StatusInternalServerError, "Failed to query player-team history"}
+	}
+	defer rows.Close()
+
+	validPlayers := make(map[int]bool)
+	for rows.Next() {
+		var pid int
+		if err := rows.Scan(&pid); err == nil {
+			validPlayers[pid] = true
+		}
+	}
+
+	seen := make(map[int]bool)
+	for _, playerID := range roster.players() {
+		if seen[playerID] {
+			return &matchStatError{http.StatusBadRequest, fmt.Sprintf("Player %d is listed more than once for team %d", playerID, teamID)}
+		}
+		seen[playerID] = true
+
+		if !validPlayers[playerID] {
+			return &matchStatError{http.StatusBadRequest, fmt.Sprintf("Player %d is not currently on team %d", playerID, teamID)}
+		}
+	}
+
+	return nil
+}
+
+// matchRosterPlayers returns the player ids registered for a team in a live match
+func matchRosterPlayers(rdb redis.Cmdable, matchID, teamID int) ([]int, error) {
+	members, err := rdb.SMembers(db.Ctx, matchRosterKey(matchID, teamID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var playerIDs []int
+	for _, member := range members {
+		if playerID, err := strconv.Atoi(member); err == nil {
+			playerIDs = append(playerIDs, playerID)
+		}
+	}
+	slices.Sort(playerIDs)
+	return playerIDs, nil
+}
+
+// GetMatchRoster returns every player registered for a match, by team, with whether they
+// are on court, on the bench or fouled out. Once the match is over the roster is read back
+// from 'matches_rosters'.
+func GetMatchRoster(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+
+	type rosterPlayer struct {
+		PlayerID int    `json:"playerId"`
+		FullName string `json:"fullName"`
+		Starter  bool   `json:"starter"`
+		Status   string `json:"status,omitempty"` // on_court, bench, fouled_out or ejected while the match is live
+		Fouls    int    `json:"fouls"`
+	}
+	roster := make(map[int][]rosterPlayer)
+
+	if isLiveMatch(matchID) {
+		homeTeamID, awayTeamID := matchTeams(matchID)
+		for _, teamID := range []int{homeTeamID, awayTeamID} {
+			players, err := liveTeamPlayers(db.Redis, matchID, teamID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			starters, _ := db.Redis.SMembers(db.Ctx, matchStartersKey(matchID, teamID)).Result()
+
+			roster[teamID] = []rosterPlayer{}
+			for _, p := range players {
+				status := "bench"
+				if p.onCourt() {
+					status = "on_court"
+				} else if ejectionReason(p.Stats) != "" {
+					status = "ejected"
+				} else if hasReachedFoulLimit(p.Stats) {
+					status = "fouled_out"
+				}
+				roster[teamID] = append(roster[teamID], rosterPlayer{
+					PlayerID: p.PlayerID,
+					Starter:  slices.Contains(starters, strconv.Itoa(p.PlayerID)),
+					Status:   status,
+					Fouls:    countPersonalFouls(p.Stats),
+				})
+			}
+		}
+
+		var playerIDs []int
+		for _, players := range roster {
+			for _, p := range players {
+				playerIDs = append(playerIDs, p.PlayerID)
+			}
+		}
+		names, err := playerNames(playerIDs)
+		if err != nil {
+			log.Printf("Failed to read player names for match %d: %v", matchID, err)
+		}
+		for teamID := range roster {
+			for i := range roster[teamID] {
+				roster[teamID][i].FullName = names[roster[teamID][i].PlayerID]
+			}
+		}
+	} else {
+		rows, err := db.PG.Query(`
+			SELECT mr.team_id, mr.player_id, CONCAT(p.first_name, ' ', p.last_name), mr.starter
+			FROM matches_rosters mr
+			JOIN players p ON p.player_id = mr.player_id
+			WHERE mr.match_id = $1
+			ORDER BY mr.team_id, mr.player_id
+		`, matchID)
+		if err != nil {
+			http.Error(w, "Database query failed", http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var teamID int
+			var p rosterPlayer
+			if err := rows.Scan(&teamID, &p.PlayerID, &p.FullName, &p.Starter); err != nil {
+				http.Error(w, "Error scanning roster data", http.StatusInternalServerError)
+				return
+			}
+			roster[teamID] = append(roster[teamID], p)
+		}
+	}
+
+	if len(roster) == 0 {
+		http.Error(w, fmt.Sprintf("No roster registered for match %d", matchID), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(roster)
+}
+
+// playerNames returns the full names of the given players
+func playerNames(playerIDs []int) (map[int]string, error) {
+	rows, err := db.PG.Query(`
+		SELECT player_id, CONCAT(first_name, ' ', last_name)
+		FROM players
+		WHERE player_id = ANY($1)
+	`, pq.Array(playerIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[int]string)
+	for rows.Next() {
+		var playerID int
+		var fullName string
+		if err := rows.Scan(&playerID, &fullName); err != nil {
+			return nil, err
+		}
+		names[playerID] = fullName
+	}
+	return names, rows.Err()
+}
+
+// syncMatchRoster saves the registered roster of a finished match to 'matches_rosters'
+func syncMatchRoster(tx *sql.Tx, matchID int) error {
+	homeTeamID, awayTeamID := matchTeams(matchID)
+
+	for _, teamID := range []int{homeTeamID, awayTeamID} {
+		playerIDs, err := matchRosterPlayers(db.Redis, matchID, teamID)
+		if err != nil {
+			return err
+		}
+		starters, err := db.Redis.SMembers(db.Ctx, matchStartersKey(matchID, teamID)).Result()
+		if err != nil {
+			return err
+		}
+
+		for _, playerID := range playerIDs {
+			_, err := tx.Exec(`
+				INSERT INTO matches_rosters (match_id, team_id, player_id, starter)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (match_id, player_id) DO NOTHING
+			`, matchID, teamID, playerID, slices.Contains(starters, strconv.Itoa(playerID)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// scorekeeperMessage is a stat submitted over the scorekeeper channel.
+// RequestID is chosen by the client and echoed back on the ack/rejection.
+type scorekeeperMessage struct {
+	RequestID string `json:"requestId"`
+	EventID   string `json:"eventId"` // optional idempotency key, resubmissions return the original outcome
+	PlayerID  int    `json:"playerId"`
+	TeamID    int    `json:"teamId"` // only for team stats
+	Minute    string `json:"minute"`
+	Period    int    `json:"period"`
+	Stat      string `json:"stat"`
+
+	AssistPlayerID int `json:"assistPlayerId"`
+	BlockPlayerID  int `json:"blockPlayerId"`
+	StealPlayerID  int `json:"stealPlayerId"`
+}
+
+// scorekeeperReply is sent back to a scorekeeper, either as the outcome of one of its
+// own submissions ("ack"/"rejected") or as a broadcast of another scorekeeper's event ("event").
+type scorekeeperReply struct {
+	Type      string       `json:"type"`
+	RequestID string       `json:"requestId,omitempty"`
+	Replayed  bool         `json:"replayed,omitempty"`
+	Status    int          `json:"status,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Events    []MatchEvent `json:"events,omitempty"`
+}
+
+const scorekeeperPingInterval = 30 * time.Second
+
+var scorekeeperUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// The UI is served from the same server, but scorekeeper tablets may run their own client
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// scorekeeperConn serializes writes, as websocket connections allow one concurrent writer only.
+type scorekeeperConn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *scorekeeperConn) send(reply scorekeeperReply) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ws.WriteJSON(reply)
+}
+
+func (c *scorekeeperConn) ping() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+}
+
+func ScorekeeperChannel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+
+	started, err := db.Redis.Get(db.Ctx, fmt.Sprintf("match:%d:started", matchID)).Result()
+	if err != nil || started != "true" {
+		http.Error(w, "Match is not live", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := scorekeeperUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client
+		log.Printf("Scorekeeper upgrade failed for match %d: %v", matchID, err)
+		return
+	}
+	conn := &scorekeeperConn{ws: ws}
+	defer ws.Close()
+
+	// Connection ids come from Redis so they stay unique across server instances
+	connID, err := db.Redis.Incr(db.Ctx, "scorekeepers:seq").Result()
+	if err != nil {
+		conn.send(scorekeeperReply{Type: "rejected", Status: http.StatusInternalServerError, Error: "Failed to register scorekeeper"})
+		return
+	}
+	source := fmt.Sprintf("scorekeeper-%d", connID)
+
+	sub := db.Redis.Subscribe(r.Context(), matchEventsChannel(matchID))
+	defer sub.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// Broadcast events entered by anyone else on this match (other scorekeepers or plain HTTP)
+	go func() {
+		ticker := time.NewTicker(scorekeeperPingInterval)
+		defer ticker.Stop()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.ping(); err != nil {
+					return
+				}
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var ev MatchEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &ev); err != nil {
+					log.Printf("Failed to decode match event: %v", err)
+					continue
+				}
+				if ev.Source == source {
+					continue
+				}
+				if err := conn.send(scorekeeperReply{Type: "event", Events: []MatchEvent{ev}}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		_, payload, err := ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Scorekeeper connection for match %d closed: %v", matchID, err)
+			}
+			return
+		}
+
+		var msg scorekeeperMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			if err := conn.send(scorekeeperReply{Type: "rejected", Status: http.StatusBadRequest, Error: "Invalid message"}); err != nil {
+				return
+			}
+			continue
+		}
+
+		events, replayed, statErr := recordMatchStatOnce(MatchStatInput{
+			MatchID:        matchID,
+			PlayerID:       msg.PlayerID,
+			TeamID:         msg.TeamID,
+			Minute:         msg.Minute,
+			Period:         msg.Period,
+			Stat:           msg.Stat,
+			AssistPlayerID: msg.AssistPlayerID,
+			BlockPlayerID:  msg.BlockPlayerID,
+			StealPlayerID:  msg.StealPlayerID,
+		}, msg.EventID, source)
+
+		reply := scorekeeperReply{Type: "ack", RequestID: msg.RequestID, Replayed: replayed, Events: events}
+		if statErr != nil {
+			reply = scorekeeperReply{Type: "rejected", RequestID: msg.RequestID, Replayed: replayed, Status: statErr.Status, Error: statErr.Message}
+		}
+
+		if err := conn.send(reply); err != nil {
+			return
+		}
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"log"
 	"net/http"
 	"skyhawk/db"
+	"slices"
 	"strconv"
-	"strings"
 
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
@@ -77,10 +77,12 @@ func GetAverageStat(w http.ResponseWriter, r *http.Request) {
 		avg = total / float64(matchCount)
 
 	} else if stat == "minutes" {
+		// Stints are paired per player, in minute order, so team totals and overtime stints add up correctly
 		query := fmt.Sprintf(`
-			SELECT match_id, stat, minute
+			SELECT match_id, player_id, stat, minute
 			FROM matches_stats
-			WHERE %s = $1 AND EXTRACT(YEAR FROM match_date) = $2
+			WHERE %s = $1 AND EXTRACT(YEAR FROM match_date) = $2 AND stat IN ('in', 'out')
+			ORDER BY match_id, player_id, minute, stat DESC -- an "out" closes a stint before an "in" at the same minute
 		`, idColumn)
 
 		rows, err := db.PG.Query(query, entityId, season)
@@ -92,59 +94,93 @@ func GetAverageStat(w http.ResponseWriter, r *http.Request) {
 		defer rows.Close()
 
 		type event struct {
-			matchID int
-			stat    string
-			minute  string
+			matchID  int
+			playerID int
+			stat     string
+			minute   string
 		}
 
-		eventsByMatch := make(map[int][]event)
+		type stintKey struct {
+			matchID  int
+			playerID int
+		}
+
+		eventsByPlayer := make(map[stintKey][]event)
 
 		for rows.Next() {
 			var ev event
-			if err := rows.Scan(&ev.matchID, &ev.stat, &ev.minute); err != nil {
+			if err := rows.Scan(&ev.matchID, &ev.playerID, &ev.stat, &ev.minute); err != nil {
 				log.Printf("Row scan error: %v", err)
 				continue
 			}
-			if ev.stat == "in" || ev.stat == "out" {
-				eventsByMatch[ev.matchID] = append(eventsByMatch[ev.matchID], ev)
-			}
+			key := stintKey{ev.matchID, ev.playerID}
+			eventsByPlayer[key] = append(eventsByPlayer[key], ev)
 		}
 
-		totalSeconds := 0.0
+		totalSeconds := 0
 
-		for _, events := range eventsByMatch {
-			var matchSeconds float64
-			var stack []float64
+		for _, events := range eventsByPlayer {
+			inTime := -1
 
 			for _, ev := range events {
-				parts := strings.Split(ev.minute, ".")
-				var min, sec int
-				if len(parts) == 1 {
-					min, _ = strconv.Atoi(parts[0]) // Only minutes, seconds default to 0
-					sec = 0
-				} else if len(parts) == 2 {
-					min, _ = strconv.Atoi(parts[0]) // Minutes
-					sec, _ = strconv.Atoi(parts[1]) // Seconds
-				} else {
-					continue
-				}
-				t := float64(min*60 + sec)
+				t := minuteToSeconds(ev.minute)
 
 				if ev.stat == "in" {
-					stack = append(stack, t)
-				} else if ev.stat == "out" && len(stack) > 0 {
-					inTime := stack[len(stack)-1]
-					stack = stack[:len(stack)-1]
+					inTime = t
+				} else if ev.stat == "out" && inTime >= 0 {
 					if t > inTime {
-						matchSeconds += t - inTime
+						totalSeconds += t - inTime
 					}
+					inTime = -1
 				}
 			}
+		}
+
+		avg = float64(totalSeconds) / float64(matchCount) / 60.0
+
+	} else if stat == "plus_minus" {
+		total, err := seasonPlusMinus(entity, idColumn, entityId, season)
+		if err != nil {
+			log.Printf("Error computing plus minus: %v", err)
+			http.Error(w, "Error computing plus minus", http.StatusInternalServerError)
+			return
+		}
+		avg = float64(total) / float64(matchCount)
+
+	} else if slices.Contains(tempoStats, stat) {
+		if entity != "team" {
+			http.Error(w, fmt.Sprintf("%s is only kept for a team", stat), http.StatusBadRequest)
+			return
+		}
+		tempo, err := seasonTempo(entityId, season)
+		if err != nil {
+			log.Printf("Error computing tempo: %v", err)
+			http.Error(w, "Error computing tempo", http.StatusInternalServerError)
+			return
+		}
+		tempo.finish(matchCount)
+		avg = tempo.value(stat)
+
+	} else if stat == "rebounds" {
+		var total int
+		for _, reboundStat := range reboundStats {
+			total += getStatCount(reboundStat)
+		}
+		avg = float64(total) / float64(matchCount)
 
-			totalSeconds += matchSeconds
+	} else if slices.Contains(shootingStats, stat) {
+		counts := make(map[string]int)
+		for _, base := range []string{"1pt", "2pt", "3pt", "1pt_miss", "2pt_miss", "3pt_miss"} {
+			counts[base] = getStatCount(base)
 		}
+		splits := shootingSplits(counts)
 
-		avg = totalSeconds / float64(matchCount) / 60.0
+		// percentages are over the season's total attempts, not an average of per game percentages
+		if slices.Contains(shootingPercentages, stat) {
+			avg = splits[stat].(float64)
+		} else {
+			avg = float64(splits[stat].(int)) / float64(matchCount)
+		}
 
 	} else {
 		avg = float64(getStatCount(stat)) / float64(matchCount)
@@ -160,3 +196,51 @@ func GetAverageStat(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// seasonMatches returns the synced matches a player or team has events in over a season
+func seasonMatches(idColumn string, id int, season string) ([]int, error) {
+	rows, err := db.PG.Query(fmt.Sprintf(`
+		SELECT DISTINCT match_id
+		FROM matches_stats
+		WHERE %s = $1 AND EXTRACT(YEAR FROM match_date) = $2
+	`, idColumn), id, season)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matchIDs []int
+	for rows.Next() {
+		var matchID int
+		if err := rows.Scan(&matchID); err != nil {
+			return nil, err
+		}
+		matchIDs = append(matchIDs, matchID)
+	}
+	return matchIDs, rows.Err()
+}
+
+// seasonTempo counts the possessions and points of a team and its opponents over the synced
+// matches of a season, replaying each match from 'matches_stats'. Pace and ratings are over the
+// season's totals, not an average of per match values.
+func seasonTempo(entityID, season string) (teamTempo, error) {
+	var tempo teamTempo
+	teamID, err := strconv.Atoi(entityID)
+	if err != nil {
+		return tempo, fmt.Errorf("invalid team id %s", entityID)
+	}
+
+	matchIDs, err := seasonMatches("team_id", teamID, season)
+	if err != nil {
+		return tempo, err
+	}
+
+	for _, matchID := range matchIDs {
+		records, live, err := loadMatchRecords(matchID)
+		if err != nil {
+			return tempo, err
+		}
+		tempo.addMatch(records, teamID, live)
+	}
+	return tempo, nil
+}
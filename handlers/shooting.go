@@ -0,0 +1,47 @@
+package handlers
+
+import "math"
+
+// Shooting splits derived from made ("1pt", "2pt", "3pt") and missed ("1pt_miss", "2pt_miss",
+// "3pt_miss") attempts. Percentages are returned on a 0-100 scale, 0 when there were no attempts.
+var shootingStats = []string{
+	"fgm", "fga", "fg_pct",
+	"3pm", "3pa", "3p_pct",
+	"ftm", "fta", "ft_pct",
+	"efg_pct", "ts_pct",
+}
+
+var shootingPercentages = []string{"fg_pct", "3p_pct", "ft_pct", "efg_pct", "ts_pct"}
+
+// shootingSplits computes every shooting stat from raw stat counts
+func shootingSplits(counts map[string]int) map[string]interface{} {
+	fgm := counts["2pt"] + counts["3pt"]
+	fga := fgm + counts["2pt_miss"] + counts["3pt_miss"]
+	threePM := counts["3pt"]
+	threePA := threePM + counts["3pt_miss"]
+	ftm := counts["1pt"]
+	fta := ftm + counts["1pt_miss"]
+	points := counts["1pt"] + 2*counts["2pt"] + 3*counts["3pt"]
+
+	return map[string]interface{}{
+		"fgm":     fgm,
+		"fga":     fga,
+		"fg_pct":  percentage(float64(fgm), float64(fga)),
+		"3pm":     threePM,
+		"3pa":     threePA,
+		"3p_pct":  percentage(float64(threePM), float64(threePA)),
+		"ftm":     ftm,
+		"fta":     fta,
+		"ft_pct":  percentage(float64(ftm), float64(fta)),
+		"efg_pct": percentage(float64(fgm)+0.5*float64(threePM), float64(fga)),
+		"ts_pct":  percentage(float64(points), 2*(float64(fga)+0.44*float64(fta))),
+	}
+}
+
+// percentage rounds to one decimal, e.g. 45.3
+func percentage(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(part/total*1000) / 10
+}
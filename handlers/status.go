@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Match lifecycle, persisted in matches.status:
+//
+//	scheduled -> live                (StartMatch)
+//	live     <-> paused              (UpdateMatchStatus)
+//	live, paused -> final            (EndMatch)
+//	final -> synced                  (once the live match is stored in Postgres)
+//	scheduled, live, paused -> cancelled
+const (
+	matchScheduled = "scheduled"
+	matchLive      = "live"
+	matchPaused    = "paused"
+	matchFinal     = "final"
+	matchSynced    = "synced"
+	matchCancelled = "cancelled"
+)
+
+var matchStatuses = []string{matchScheduled, matchLive, matchPaused, matchFinal, matchSynced, matchCancelled}
+
+// statuses a match can move to, by current status
+var matchTransitions = map[string][]string{
+	matchScheduled: {matchLive, matchCancelled},
+	matchLive:      {matchPaused, matchFinal, matchCancelled},
+	matchPaused:    {matchLive, matchFinal, matchCancelled},
+	matchFinal:     {matchSynced},
+}
+
+// transitionsFrom returns the statuses a match can reach the given status from
+func transitionsFrom(to string) []string {
+	var from []string
+	for _, status := range matchStatuses {
+		if slices.Contains(matchTransitions[status], to) {
+			from = append(from, status)
+		}
+	}
+	return from
+}
+
+func matchPausedKey(matchID int) string {
+	return fmt.Sprintf("match:%d:paused", matchID)
+}
+
+func matchStatus(matchID int) (string, error) {
+	var status string
+	err := db.PG.QueryRow(`SELECT status FROM matches WHERE match_id = $1`, matchID).Scan(&status)
+	return status, err
+}
+
+// transitionMatchStatus moves a match to the given status, if its current status allows it.
+// The check and the update are a single statement, so of two concurrent transitions only one wins.
+func transitionMatchStatus(matchID int, to string) *matchStatError {
+	result, err := db.PG.Exec(`
+		UPDATE matches SET status = $1 WHERE match_id = $2 AND status = ANY($3)
+	`, to, matchID, pq.Array(transitionsFrom(to)))
+	if err != nil {
+		return &matchStatError{http.StatusInternalServerError, "Failed to update match status"}
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		status, err := matchStatus(matchID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return &matchStatError{http.StatusNotFound, "Match not found"}
+		}
+		if err != nil {
+			return &matchStatError{http.StatusInternalServerError, "Failed to read match status"}
+		}
+		return &matchStatError{http.StatusConflict, fmt.Sprintf("Match %d is %s, it can't become %s", matchID, status, to)}
+	}
+
+	return nil
+}
+
+// revertMatchStatus undoes a transition whose follow-up failed
+func revertMatchStatus(matchID int, from, to string) {
+	if _, err := db.PG.Exec(`
+		UPDATE matches SET status = $1 WHERE match_id = $2 AND status = $3
+	`, from, matchID, to); err != nil {
+		log.Printf("Failed to revert match %d from %s to %s: %v", matchID, to, from, err)
+	}
+}
+
+func isPausedMatch(matchID int) bool {
+	paused, _ := db.Redis.Get(db.Ctx, matchPausedKey(matchID)).Result()
+	return paused == "true"
+}
+
+// UpdateMatchStatus pauses, resumes or cancels a match.
+// Starting and ending a match go through StartMatch and EndMatch, which set up and store its stats.
+func UpdateMatchStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !slices.Contains([]string{matchLive, matchPaused, matchCancelled}, req.Status) {
+		http.Error(w, fmt.Sprintf("Status can only be set to %s, %s or %s", matchLive, matchPaused, matchCancelled), http.StatusBadRequest)
+		return
+	}
+
+	previous, err := matchStatus(matchID)
+	if err != nil {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+
+	// only a paused match is resumed here, a scheduled one is started with its rosters
+	if req.Status == matchLive && previous == matchScheduled {
+		http.Error(w, "A scheduled match is started through /api/start_match", http.StatusBadRequest)
+		return
+	}
+
+	if statErr := transitionMatchStatus(matchID, req.Status); statErr != nil {
+		http.Error(w, statErr.Message, statErr.Status)
+		return
+	}
+
+	ev := MatchEvent{Type: req.Status, MatchID: matchID}
+	switch req.Status {
+	case matchPaused:
+		err = db.Redis.Set(db.Ctx, matchPausedKey(matchID), "true", 0).Err()
+	case matchLive:
+		err = db.Redis.Del(db.Ctx, matchPausedKey(matchID)).Err()
+	case matchCancelled:
+		if previous != matchScheduled {
+			// published before the live match, its event log and stream included, is dropped
+			publishMatchEvent(ev)
+			err = discardLiveMatch(matchID)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to apply status %s to live match %d: %v", req.Status, matchID, err)
+		revertMatchStatus(matchID, previous, req.Status)
+		http.Error(w, "Failed to update live match", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Status != matchCancelled {
+		emitMatchEvent(ev)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"matchId": matchID, "status": req.Status})
+}
+
+// discardLiveMatch drops the live stats of a cancelled match, nothing of it is stored
+func discardLiveMatch(matchID int) error {
+	keys, err := matchRedisKeys(matchID)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Redis.SRem(db.Ctx, activeMatchesKey, matchID).Err(); err != nil {
+		return err
+	}
+	keys = append(keys, matchStreamKey(matchID))
+	if err := db.Redis.SRem(db.Ctx, streamedMatchesKey, matchID).Err(); err != nil {
+		return err
+	}
+	return db.Redis.Del(db.Ctx, keys...).Err()
+}
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"skyhawk/db"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Live store modes.
+// With "lists", the default, a live match is its players' and teams' Redis lists only.
+// With "streams", a live match is a single stream (match:{id}:stream) which keeps the recording
+// order across players: every change is appended to it, and only to it. The players' and teams'
+// lists are derived from the stream, as a projection kept in minute order (see projection.go),
+// and are what the validations and the per-player summaries read.
+// The whole match is read from the stream, in order: the match records, and its two consumer
+// groups, "syncer", which copies the match into Postgres once it ends, and "feeds", which relays
+// the events to the live subscribers (SSE and scorekeeper sockets).
+const (
+	LiveStoreLists   = "lists"
+	LiveStoreStreams = "streams"
+)
+
+const (
+	streamSyncerGroup = "syncer"
+	streamFeedsGroup  = "feeds"
+
+	// matches whose stream may still get events to relay to the feeds, until it expires: a final
+	// match is still corrected and synced after its "end"
+	streamedMatchesKey = "matches:streamed"
+
+	// a synced match keeps its stream for a while, so the feeds can catch up
+	syncedStreamTTL = time.Hour
+
+	feedsRelayBlock = 2 * time.Second
+	// how long a relay keeps a match stream to itself without renewing its lease
+	feedsRelayLease = 10 * time.Second
+)
+
+var liveStore = LiveStoreLists
+
+// SetLiveStore selects how the matches started from now on are kept in Redis, "lists" when empty
+func SetLiveStore(mode string) error {
+	switch mode {
+	case "", LiveStoreLists:
+		liveStore = LiveStoreLists
+	case LiveStoreStreams:
+		liveStore = LiveStoreStreams
+	default:
+		return fmt.Errorf("unknown live store %q, expected %q or %q", mode, LiveStoreLists, LiveStoreStreams)
+	}
+	return nil
+}
+
+// streamStore tells whether matches started now get a stream
+func streamStore() bool {
+	return liveStore == LiveStoreStreams
+}
+
+func matchStreamKey(matchID int) string {
+	return fmt.Sprintf("match:%d:stream", matchID)
+}
+
+// A match keeps the live store it was started with for its whole life, whatever the mode of the
+// instances handling it later. Matches with a stream are marked in match:{id}:live_store.
+func matchLiveStoreKey(matchID int) string {
+	return fmt.Sprintf("match:%d:live_store", matchID)
+}
+
+// matchStreamStore tells whether a live match was started with the streams live store
+func matchStreamStore(matchID int) bool {
+	store, err := db.Redis.Get(db.Ctx, matchLiveStoreKey(matchID)).Result()
+	return err == nil && store == LiveStoreStreams
+}
+
+// startMatchStream creates the stream of a match along with its consumer groups
+func startMatchStream(matchID int) error {
+	for _, group := range []string{streamSyncerGroup, streamFeedsGroup} {
+		err := db.Redis.XGroupCreateMkStream(db.Ctx, matchStreamKey(matchID), group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+	if err := db.Redis.Set(db.Ctx, matchLiveStoreKey(matchID), LiveStoreStreams, 0).Err(); err != nil {
+		return err
+	}
+	return db.Redis.SAdd(db.Ctx, streamedMatchesKey, matchID).Err()
+}
+
+// addStreamEvent appends an event to the stream of its match. The event carries its score,
+// as the match may be cleared from Redis by the time the feeds relay it. record is the stat
+// record a "stat" or "amend" event projects to its player's list (see projection.go), empty
+// for the other events. Within a pipeline the error is only known once it is executed.
+func addStreamEvent(rdb redis.Cmdable, ev MatchEvent, record string) error {
+	eventJSON, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	values := map[string]interface{}{"event": eventJSON}
+	if record != "" {
+		values["record"] = record
+	}
+	return rdb.XAdd(db.Ctx, &redis.XAddArgs{
+		Stream: matchStreamKey(ev.MatchID),
+		Values: values,
+	}).Err()
+}
+
+// emitMatchEvent hands an event over to the live subscribers: published right away with
+// lists, appended to the match stream for the feeds relay with streams.
+func emitMatchEvent(ev MatchEvent) MatchEvent {
+	if !matchStreamStore(ev.MatchID) {
+		return publishMatchEvent(ev)
+	}
+	ev = scoreMatchEvent(db.Redis, ev)
+	if err := addStreamEvent(db.Redis, ev, ""); err != nil {
+		log.Printf("Failed to append %s event to the stream of match %d: %v", ev.Type, ev.MatchID, err)
+	}
+	return ev
+}
+
+// announceMatchEvent is emitMatchEvent for changes whose stream event was appended, scored,
+// along with them. The event returned carries the score as it is now.
+func announceMatchEvent(ev MatchEvent) MatchEvent {
+	if !matchStreamStore(ev.MatchID) {
+		return publishMatchEvent(ev)
+	}
+	return scoreMatchEvent(db.Redis, ev)
+}
+
+func streamMessageEvent(msg redis.XMessage) (MatchEvent, error) {
+	var ev MatchEvent
+	raw, ok := msg.Values["event"].(string)
+	if !ok {
+		return ev, fmt.Errorf("stream entry %s has no event", msg.ID)
+	}
+	err := json.Unmarshal([]byte(raw), &ev)
+	return ev, err
+}
+
+// replayStreamEvents applies the stat, amend and delete events of a match stream in order,
+// and returns the records left, in recording order
+func replayStreamEvents(messages []redis.XMessage) []matchRecord {
+	var records []matchRecord
+	positions := make(map[string]int)
+	deleted := make(map[string]bool)
+
+	for _, msg := range messages {
+		ev, err := streamMessageEvent(msg)
+		if err != nil {
+			log.Printf("Skipping stream entry: %v", err)
+			continue
+		}
+
+		record := matchRecord{
+			EventID:        ev.EventID,
+			TeamID:         ev.TeamID,
+			PlayerID:       ev.PlayerID,
+			Minute:         ev.Minute,
+			Period:         ev.Period,
+			Stat:           ev.Stat,
+			LinkedPlayerID: ev.LinkedPlayerID,
+			LinkedEventID:  ev.LinkedEventID,
+		}
+
+		switch ev.Type {
+		case "stat":
+			positions[ev.EventID] = len(records)
+			records = append(records, record)
+		case "amend":
+			if i, ok := positions[ev.EventID]; ok {
+				records[i] = record
+			}
+		case "delete":
+			deleted[ev.EventID] = true
+		}
+	}
+
+	var remaining []matchRecord
+	for _, record := range records {
+		if !deleted[record.EventID] {
+			remaining = append(remaining, record)
+		}
+	}
+	return remaining
+}
+
+// streamMatchRecords returns the records of a live match from its stream
+func streamMatchRecords(matchID int) ([]matchRecord, error) {
+	messages, err := db.Redis.XRange(db.Ctx, matchStreamKey(matchID), "-", "+").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the stream of match %d", matchID)
+	}
+	return replayStreamEvents(messages), nil
+}
+
+// syncerMatchRecords reads the stream of a match through the syncer group and returns its
+// records, along with the ids of the entries to acknowledge once they are stored. Entries
+// delivered to an earlier sync that failed are read again first.
+func syncerMatchRecords(matchID int) ([]matchRecord, []string, error) {
+	key := matchStreamKey(matchID)
+	var messages []redis.XMessage
+
+	for _, start := range []string{"0", ">"} {
+		for {
+			res, err := db.Redis.XReadGroup(db.Ctx, &redis.XReadGroupArgs{
+				Group:    streamSyncerGroup,
+				Consumer: streamSyncerGroup,
+				Streams:  []string{key, start},
+				Count:    500,
+				Block:    -1,
+			}).Result()
+			if errors.Is(err, redis.Nil) {
+				break
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(res) == 0 || len(res[0].Messages) == 0 {
+				break
+			}
+
+			read := res[0].Messages
+			messages = append(messages, read...)
+			if start != ">" {
+				// pending entries are paged by id
+				start = read[len(read)-1].ID
+			}
+		}
+	}
+
+	var ids []string
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+	return replayStreamEvents(messages), ids, nil
+}
+
+// completeMatchStream acknowledges the synced entries of a match stream and lets it expire.
+// Nothing happens for a match without a stream.
+func completeMatchStream(matchID int, ids []string) error {
+	if len(ids) > 0 {
+		if err := db.Redis.XAck(db.Ctx, matchStreamKey(matchID), streamSyncerGroup, ids...).Err(); err != nil {
+			return err
+		}
+	}
+	return db.Redis.Expire(db.Ctx, matchStreamKey(matchID), syncedStreamTTL).Err()
+}
+
+// Lease on relaying a match stream, outside the "match:*" key space like the events channel.
+// Events must reach the event log in stream order, for Last-Event-ID resume, so the events of
+// a match are relayed by one relay at a time: the one holding the lease.
+func feedsRelayLeaseKey(matchID int) string {
+	return fmt.Sprintf("relay:match:%d", matchID)
+}
+
+// holdRelayLeaseScript takes the lease of a stream for a relay, or renews it if the relay holds
+// it already. KEYS: lease. ARGV: relay, lease in milliseconds. It returns whether the relay holds it.
+var holdRelayLeaseScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+func holdRelayLease(matchID int, consumer string) bool {
+	held, err := holdRelayLeaseScript.Run(db.Ctx, db.Redis, []string{feedsRelayLeaseKey(matchID)}, consumer, feedsRelayLease.Milliseconds()).Int()
+	return err == nil && held == 1
+}
+
+// StartFeedsRelay starts relaying the events of the match streams to the live subscribers.
+// Every instance runs one relay, whatever its live store, as matches started with streams may
+// still be played after a switch back to lists. Each match stream is relayed by the relay
+// holding its lease, the others relay the other matches or wait for the lease to run out.
+func StartFeedsRelay() {
+	hostname, _ := os.Hostname()
+	consumer := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	go func() {
+		for {
+			relaying, err := relayStreamEvents(consumer)
+			if err != nil {
+				log.Printf("[Feeds relay] %v", err)
+				time.Sleep(time.Second)
+			} else if !relaying {
+				time.Sleep(feedsRelayBlock)
+			}
+		}
+	}()
+}
+
+// relayStreamEvents relays the new events of the match streams whose lease the relay holds, and
+// tells whether it holds any
+func relayStreamEvents(consumer string) (bool, error) {
+	members, err := db.Redis.SMembers(db.Ctx, streamedMatchesKey).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch streamed matches: %v", err)
+	}
+
+	var streams []string
+	held := make(map[string]int)
+	for _, member := range members {
+		matchID, err := strconv.Atoi(member)
+		if err != nil || !holdRelayLease(matchID, consumer) {
+			continue
+		}
+		stream := matchStreamKey(matchID)
+		streams = append(streams, stream)
+		held[stream] = matchID
+
+		// entries appended by an instance that stopped before projecting them
+		if err := projectMatchStream(matchID); err != nil {
+			log.Printf("[Feeds relay] %v", err)
+		}
+
+		// events delivered to an earlier holder of the lease that stopped before acknowledging
+		// them come before any new one
+		if err := claimStreamMessages(stream, consumer); err != nil {
+			log.Printf("[Feeds relay] Failed to take over pending events of %s: %v", stream, err)
+		}
+	}
+	if len(streams) == 0 {
+		return false, nil
+	}
+
+	for range len(streams) {
+		streams = append(streams, ">")
+	}
+	res, err := db.Redis.XReadGroup(db.Ctx, &redis.XReadGroupArgs{
+		Group:    streamFeedsGroup,
+		Consumer: consumer,
+		Streams:  streams,
+		Count:    100,
+		Block:    feedsRelayBlock,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return true, nil
+	}
+	if err != nil {
+		// a synced stream expired or was cleared
+		pruneStreamedMatches(members)
+		return true, fmt.Errorf("failed to read match streams: %v", err)
+	}
+
+	for _, stream := range res {
+		// a relay that lost the lease while reading leaves the events to the new holder
+		if !holdRelayLease(held[stream.Stream], consumer) {
+			continue
+		}
+		relayStreamMessages(stream.Stream, stream.Messages)
+	}
+	return true, nil
+}
+
+// claimStreamMessages relays the events of a stream pending in the feeds group, whichever relay
+// they were delivered to. Only the holder of the stream's lease calls it.
+func claimStreamMessages(stream, consumer string) error {
+	start := "0"
+	for {
+		messages, next, err := db.Redis.XAutoClaim(db.Ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    streamFeedsGroup,
+			Consumer: consumer,
+			Start:    start,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		relayStreamMessages(stream, messages)
+		if next == "0-0" || len(messages) == 0 {
+			return nil
+		}
+		start = next
+	}
+}
+
+func relayStreamMessages(stream string, messages []redis.XMessage) {
+	for _, msg := range messages {
+		ev, err := streamMessageEvent(msg)
+		if err != nil {
+			log.Printf("[Feeds relay] Skipping entry of %s: %v", stream, err)
+		} else {
+			logMatchEvent(ev)
+		}
+
+		if err := db.Redis.XAck(db.Ctx, stream, streamFeedsGroup, msg.ID).Err(); err != nil {
+			log.Printf("[Feeds relay] Failed to acknowledge %s of %s: %v", msg.ID, stream, err)
+		}
+	}
+}
+
+// pruneStreamedMatches stops relaying the matches whose stream is gone
+func pruneStreamedMatches(members []string) {
+	for _, member := range members {
+		matchID, err := strconv.Atoi(member)
+		if err != nil {
+			continue
+		}
+		if n, err := db.Redis.Exists(db.Ctx, matchStreamKey(matchID)).Result(); err == nil && n == 0 {
+			db.Redis.SRem(db.Ctx, streamedMatchesKey, member)
+		}
+	}
+}
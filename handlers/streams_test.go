@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"skyhawk/db"
+	"slices"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// startTestStreamMatch is startTestMatch with the streams live store
+func startTestStreamMatch(t *testing.T, onCourt int) {
+	t.Helper()
+
+	previous := liveStore
+	liveStore = LiveStoreStreams
+	t.Cleanup(func() { liveStore = previous })
+
+	startTestMatch(t, onCourt)
+}
+
+func TestStreamRecordsMatchLists(t *testing.T) {
+	startTestStreamMatch(t, playersOnCourt)
+	shooterID := testHomeTeam*10 + 1
+	assistID := testHomeTeam*10 + 2
+
+	inputs := []MatchStatInput{
+		{MatchID: testMatchID, PlayerID: shooterID, Minute: "02.10", Stat: "2pt", AssistPlayerID: assistID},
+		{MatchID: testMatchID, PlayerID: testAwayTeam*10 + 1, Minute: "01.30", Stat: "3pt_miss"},
+		{MatchID: testMatchID, TeamID: testAwayTeam, Minute: "03.00", Stat: "full_timeouts"},
+		{MatchID: testMatchID, PlayerID: shooterID, Minute: "04.00", Stat: "fouls"},
+	}
+	for _, input := range inputs {
+		if _, statErr := recordMatchStat(input, ""); statErr != nil {
+			t.Fatalf("failed to record %s: %v", input.Stat, statErr.Message)
+		}
+	}
+
+	fromStream, err := liveMatchRecords(testMatchID)
+	if err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+
+	fromLists, err := listMatchRecords(testMatchID)
+	if err != nil {
+		t.Fatalf("failed to read lists: %v", err)
+	}
+
+	byEventID := func(a, b matchRecord) int { return compareEventIDs(a.EventID, b.EventID) }
+	slices.SortFunc(fromStream, byEventID)
+	slices.SortFunc(fromLists, byEventID)
+	if !slices.Equal(fromStream, fromLists) {
+		t.Errorf("stream records differ from the lists:\nstream: %+v\nlists:  %+v", fromStream, fromLists)
+	}
+}
+
+func TestSyncerRereadsUnacknowledged(t *testing.T) {
+	startTestStreamMatch(t, playersOnCourt)
+
+	// the starters' "in" were appended before the groups existed, from "0" they are still read
+	records, ids, err := syncerMatchRecords(testMatchID)
+	if err != nil {
+		t.Fatalf("failed to read through the syncer group: %v", err)
+	}
+	if want := 2 * playersOnCourt; len(records) != want || len(ids) != want {
+		t.Fatalf("read %d records from %d entries, want %d", len(records), len(ids), want)
+	}
+
+	// a failed sync acknowledges nothing, so the next one gets the same entries plus the new ones
+	if _, statErr := recordMatchStat(MatchStatInput{MatchID: testMatchID, PlayerID: testHomeTeam*10 + 1, Minute: "01.00", Stat: "steals"}, ""); statErr != nil {
+		t.Fatalf("failed to record steal: %v", statErr.Message)
+	}
+	records, ids, err = syncerMatchRecords(testMatchID)
+	if err != nil {
+		t.Fatalf("failed to read through the syncer group: %v", err)
+	}
+	if want := 2*playersOnCourt + 1; len(records) != want {
+		t.Fatalf("read %d records after a failed sync, want %d", len(records), want)
+	}
+
+	if err := completeMatchStream(testMatchID, ids); err != nil {
+		t.Fatalf("failed to acknowledge: %v", err)
+	}
+	records, _, err = syncerMatchRecords(testMatchID)
+	if err != nil {
+		t.Fatalf("failed to read through the syncer group: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("read %d records after the sync completed, want 0", len(records))
+	}
+	if ttl := db.Redis.TTL(db.Ctx, matchStreamKey(testMatchID)).Val(); ttl <= 0 {
+		t.Errorf("synced stream has no expiry")
+	}
+}
+
+func TestFeedsRelayPublishesOnce(t *testing.T) {
+	startTestStreamMatch(t, playersOnCourt)
+
+	if _, statErr := recordMatchStat(MatchStatInput{MatchID: testMatchID, PlayerID: testHomeTeam*10 + 1, Minute: "01.00", Stat: "2pt"}, ""); statErr != nil {
+		t.Fatalf("failed to record 2pt: %v", statErr.Message)
+	}
+	if published := db.Redis.LLen(db.Ctx, matchEventsKey(testMatchID)).Val(); published != 0 {
+		t.Fatalf("%d events published before the relay ran", published)
+	}
+
+	// the relay holding the lease of the match relays all of its events, the other one none
+	for _, consumer := range []string{"a", "b"} {
+		if _, err := relayStreamEvents(consumer); err != nil {
+			t.Fatalf("relay %s failed: %v", consumer, err)
+		}
+	}
+
+	streamed := db.Redis.XLen(db.Ctx, matchStreamKey(testMatchID)).Val()
+	if published := db.Redis.LLen(db.Ctx, matchEventsKey(testMatchID)).Val(); published != streamed {
+		t.Errorf("relayed %d events, want %d", published, streamed)
+	}
+}
+
+func TestListsMatchKeepsListsAfterSwitch(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+
+	previous := liveStore
+	liveStore = LiveStoreStreams
+	t.Cleanup(func() { liveStore = previous })
+
+	if _, statErr := recordMatchStat(MatchStatInput{MatchID: testMatchID, PlayerID: testHomeTeam*10 + 1, Minute: "02.00", Stat: "steals"}, ""); statErr != nil {
+		t.Fatalf("failed to record steal: %v", statErr.Message)
+	}
+
+	if n := db.Redis.Exists(db.Ctx, matchStreamKey(testMatchID)).Val(); n != 0 {
+		t.Errorf("a match started with lists got a stream")
+	}
+	records, err := liveMatchRecords(testMatchID)
+	if err != nil || len(records) != 2*playersOnCourt+1 {
+		t.Errorf("read %d records (%v), want %d from the lists", len(records), err, 2*playersOnCourt+1)
+	}
+}
+
+func TestRelayedEventsKeepTheirScore(t *testing.T) {
+	startTestStreamMatch(t, playersOnCourt)
+
+	for _, input := range []MatchStatInput{
+		{MatchID: testMatchID, PlayerID: testHomeTeam*10 + 1, Minute: "01.00", Stat: "3pt"},
+		{MatchID: testMatchID, PlayerID: testAwayTeam*10 + 1, Minute: "02.00", Stat: "2pt"},
+	} {
+		if _, statErr := recordMatchStat(input, ""); statErr != nil {
+			t.Fatalf("failed to record %s: %v", input.Stat, statErr.Message)
+		}
+	}
+	emitMatchEvent(MatchEvent{Type: "end", MatchID: testMatchID})
+
+	// the syncer clears the match before the feeds get to relay it
+	keys, _ := matchRedisKeys(testMatchID)
+	db.Redis.Del(db.Ctx, keys...)
+
+	if _, err := relayStreamEvents("a"); err != nil {
+		t.Fatalf("relay failed: %v", err)
+	}
+
+	logged, _ := db.Redis.LRange(db.Ctx, matchEventsKey(testMatchID), 0, -1).Result()
+	if len(logged) == 0 {
+		t.Fatalf("nothing relayed")
+	}
+	var end MatchEvent
+	json.Unmarshal([]byte(logged[len(logged)-1]), &end)
+	if end.Type != "end" || end.HomeTeam != testHomeTeam || end.HomeScore != 3 || end.AwayScore != 2 {
+		t.Errorf("relayed %s event scored %d-%d for team %d, want end 3-2 for team %d", end.Type, end.HomeScore, end.AwayScore, end.HomeTeam, testHomeTeam)
+	}
+}
+
+func TestRelayKeepsEndedMatch(t *testing.T) {
+	startTestStreamMatch(t, playersOnCourt)
+
+	emitMatchEvent(MatchEvent{Type: "end", MatchID: testMatchID})
+	if _, err := relayStreamEvents("a"); err != nil {
+		t.Fatalf("relay failed: %v", err)
+	}
+
+	// a correction of the final match, before it is synced
+	emitMatchEvent(MatchEvent{Type: "delete", MatchID: testMatchID, EventID: "1"})
+	if _, err := relayStreamEvents("a"); err != nil {
+		t.Fatalf("relay failed: %v", err)
+	}
+
+	logged, _ := db.Redis.LRange(db.Ctx, matchEventsKey(testMatchID), -1, -1).Result()
+	var last MatchEvent
+	if len(logged) == 0 || json.Unmarshal([]byte(logged[0]), &last) != nil || last.Type != "delete" {
+		t.Errorf("last relayed event %v, want the delete made after the end", logged)
+	}
+}
+
+func TestRelayTakesOverInStreamOrder(t *testing.T) {
+	startTestStreamMatch(t, playersOnCourt)
+	if _, err := relayStreamEvents("a"); err != nil {
+		t.Fatalf("relay failed: %v", err)
+	}
+
+	for _, minute := range []string{"01.00", "02.00"} {
+		if _, statErr := recordMatchStat(MatchStatInput{MatchID: testMatchID, PlayerID: testHomeTeam*10 + 1, Minute: minute, Stat: "steals"}, ""); statErr != nil {
+			t.Fatalf("failed to record steal: %v", statErr.Message)
+		}
+	}
+
+	// relay "a" reads the first steal and stops before relaying it, then its lease runs out
+	if err := db.Redis.XReadGroup(db.Ctx, &redis.XReadGroupArgs{
+		Group:    streamFeedsGroup,
+		Consumer: "a",
+		Streams:  []string{matchStreamKey(testMatchID), ">"},
+		Count:    1,
+		Block:    -1,
+	}).Err(); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if _, err := relayStreamEvents("b"); err != nil {
+		t.Fatalf("relay b failed: %v", err)
+	}
+	if published := db.Redis.LLen(db.Ctx, matchEventsKey(testMatchID)).Val(); published != 2*playersOnCourt {
+		t.Fatalf("relay b relayed while a held the lease, %d events logged", published)
+	}
+
+	db.Redis.Del(db.Ctx, feedsRelayLeaseKey(testMatchID))
+	if _, err := relayStreamEvents("b"); err != nil {
+		t.Fatalf("relay b failed: %v", err)
+	}
+
+	logged, _ := db.Redis.LRange(db.Ctx, matchEventsKey(testMatchID), 0, -1).Result()
+	var minutes []string
+	for _, payload := range logged {
+		var ev MatchEvent
+		json.Unmarshal([]byte(payload), &ev)
+		if ev.Stat == "steals" {
+			minutes = append(minutes, ev.Minute)
+		}
+	}
+	if !slices.Equal(minutes, []string{"01.00", "02.00"}) {
+		t.Errorf("steals relayed at minutes %v, want them in stream order", minutes)
+	}
+}
+
+func TestCorrectionsProjectedFromStream(t *testing.T) {
+	startTestStreamMatch(t, playersOnCourt)
+	playerID := testHomeTeam*10 + 1
+
+	var eventIDs []string
+	for _, minute := range []string{"05.00", "03.00", "04.00"} {
+		events, statErr := recordMatchStat(MatchStatInput{MatchID: testMatchID, PlayerID: playerID, Minute: minute, Stat: "steals"}, "")
+		if statErr != nil {
+			t.Fatalf("failed to record steal: %v", statErr.Message)
+		}
+		eventIDs = append(eventIDs, events[0].EventID)
+	}
+	if code := correctEvent(http.MethodPatch, eventIDs[0], `{"minute": "01.00"}`); code != http.StatusOK {
+		t.Fatalf("amend answered %d", code)
+	}
+	if code := correctEvent(http.MethodDelete, eventIDs[2], ""); code != http.StatusOK {
+		t.Fatalf("delete answered %d", code)
+	}
+
+	stats, _ := db.Redis.LRange(db.Ctx, playerStatsKey(testMatchID, testHomeTeam, playerID), 0, -1).Result()
+	var minutes []string
+	for _, raw := range stats {
+		minutes = append(minutes, recordMinute(raw))
+	}
+	if want := []string{"00.00", "01.00", "03.00"}; !slices.Equal(minutes, want) {
+		t.Errorf("projected list at minutes %v, want %v", minutes, want)
+	}
+	if _, statErr := findStatEvent(db.Redis, testMatchID, eventIDs[2]); statErr == nil {
+		t.Errorf("deleted event %s still indexed", eventIDs[2])
+	}
+}
+
+func TestValidationCatchesUpProjection(t *testing.T) {
+	startTestStreamMatch(t, playersOnCourt)
+	playerID := testHomeTeam*10 + 1
+
+	// an "out" appended by an instance that stopped before projecting it
+	record := `{"id":"100","minute":"02.00","period":"1","stat":"out"}`
+	out := MatchEvent{Type: "stat", MatchID: testMatchID, EventID: "100", TeamID: testHomeTeam, PlayerID: playerID, Minute: "02.00", Period: 1, Stat: "out"}
+	if err := addStreamEvent(db.Redis, out, record); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	_, statErr := recordMatchStat(MatchStatInput{MatchID: testMatchID, PlayerID: playerID, Minute: "03.00", Stat: "steals"}, "")
+	if statErr == nil || statErr.Status != http.StatusBadRequest {
+		t.Errorf("steal of a player out of play: error %v, want 400", statErr)
+	}
+}
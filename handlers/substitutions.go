@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+)
+
+const playersOnCourt = 5
+
+// livePlayer is a player of a team in a live match along with their recorded stats
+type livePlayer struct {
+	PlayerID int
+	RedisKey string
+	Stats    []string
+}
+
+func (p livePlayer) onCourt() bool {
+	return validatePlayerInPlay(slices.Clone(p.Stats)) == nil
+}
+
+func (p livePlayer) disqualified() bool {
+	return isDisqualified(p.Stats)
+}
+
+// liveTeamPlayers returns every player registered on a team's roster for a live match,
+// bench players included even before they record a stat
+func liveTeamPlayers(rdb redis.Cmdable, matchID, teamID int) ([]livePlayer, error) {
+	playerIDs, err := matchRosterPlayers(rdb, matchID, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read roster of team %d", teamID)
+	}
+
+	var players []livePlayer
+	for _, playerID := range playerIDs {
+		key := fmt.Sprintf("match:%d:team:%d:player:%d:stats", matchID, teamID, playerID)
+		stats, err := rdb.LRange(db.Ctx, key, 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stats for key %s", key)
+		}
+		players = append(players, livePlayer{PlayerID: playerID, RedisKey: key, Stats: stats})
+	}
+
+	return players, nil
+}
+
+func countOnCourt(players []livePlayer) int {
+	count := 0
+	for _, p := range players {
+		if p.onCourt() {
+			count++
+		}
+	}
+	return count
+}
+
+// validateSingleInOut applies the five-on-court rule to an "in" or "out" sent on its own
+// through AddMatchStat. The only one that can keep a team at five is an "in" for a team
+// left with four, e.g. after a foul-out with no one on the bench.
+func validateSingleInOut(rdb redis.Cmdable, matchID, teamID int, stat string) *matchStatError {
+	players, err := liveTeamPlayers(rdb, matchID, teamID)
+	if err != nil {
+		return &matchStatError{http.StatusInternalServerError, err.Error()}
+	}
+
+	after := countOnCourt(players)
+	if stat == "in" {
+		after++
+	} else {
+		after--
+	}
+
+	if after != playersOnCourt {
+		return &matchStatError{http.StatusBadRequest, fmt.Sprintf("Team %d would have %d players on court, use /api/matches/%d/substitutions to swap players", teamID, after, matchID)}
+	}
+	return nil
+}
+
+// validateCourtCorrection applies the five-on-court rule to a correction that deletes, moves or
+// changes an "in" or "out": replayed in minute order with the corrected lists, the team never has
+// more than five on court, and it has as many on court now as it had before the correction.
+func validateCourtCorrection(rdb redis.Cmdable, matchID, teamID int, edits statListEdits) *matchStatError {
+	players, err := liveTeamPlayers(rdb, matchID, teamID)
+	if err != nil {
+		return &matchStatError{http.StatusInternalServerError, err.Error()}
+	}
+
+	before := countOnCourt(players)
+	for i, p := range players {
+		if stats, ok := edits[p.RedisKey]; ok {
+			players[i].Stats = stats
+		}
+	}
+	if after := countOnCourt(players); after != before {
+		return &matchStatError{http.StatusBadRequest, fmt.Sprintf("Correction leaves team %d with %d players on court, use /api/matches/%d/substitutions to swap players", teamID, after, matchID)}
+	}
+
+	type courtChange struct {
+		minute string
+		delta  int
+	}
+	var changes []courtChange
+	for _, p := range players {
+		for _, raw := range p.Stats {
+			var record map[string]string
+			if err := json.Unmarshal([]byte(raw), &record); err != nil {
+				continue
+			}
+			switch record["stat"] {
+			case "in":
+				changes = append(changes, courtChange{record["minute"], 1})
+			case "out":
+				changes = append(changes, courtChange{record["minute"], -1})
+			}
+		}
+	}
+	// an "out" frees its place before an "in" at the same minute takes it
+	slices.SortFunc(changes, func(a, b courtChange) int {
+		if c := minuteToSeconds(a.minute) - minuteToSeconds(b.minute); c != 0 {
+			return c
+		}
+		return a.delta - b.delta
+	})
+
+	onCourt := 0
+	for _, change := range changes {
+		onCourt += change.delta
+		if onCourt > playersOnCourt {
+			return &matchStatError{http.StatusBadRequest, fmt.Sprintf("Correction leaves team %d with %d players on court at minute %s", teamID, onCourt, change.minute)}
+		}
+	}
+	return nil
+}
+
+func SubstitutePlayers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+
+	var sub struct {
+		TeamID int    `json:"teamId"`
+		Minute string `json:"minute"`
+		Period int    `json:"period"`
+		Out    []int  `json:"out"`
+		In     []int  `json:"in"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !isValidMinuteValue(sub.Minute) {
+		http.Error(w, "Invalid minute value", http.StatusBadRequest)
+		return
+	}
+
+	period, err := resolveEventPeriod(matchID, sub.Minute, sub.Period)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(sub.Out) == 0 && len(sub.In) == 0 {
+		http.Error(w, "At least one player must go in or out", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := matchStatsKeys(matchID)
+	if err != nil {
+		http.Error(w, "Failed to read match roster from Redis", http.StatusInternalServerError)
+		return
+	}
+
+	// All players swap in a single transaction, so the team is never seen with more or less than five
+	writes, statErr := runStatTx(matchID, "", keys, func(tx *redis.Tx) ([]statWrite, *matchStatError) {
+		players, err := liveTeamPlayers(tx, matchID, sub.TeamID)
+		if err != nil {
+			return nil, &matchStatError{http.StatusInternalServerError, err.Error()}
+		}
+		if len(players) == 0 {
+			return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Team %d is not playing in match %d", sub.TeamID, matchID)}
+		}
+
+		byID := make(map[int]livePlayer)
+		for _, p := range players {
+			byID[p.PlayerID] = p
+		}
+
+		seen := make(map[int]bool)
+		for _, group := range [][]int{sub.Out, sub.In} {
+			for _, playerID := range group {
+				if seen[playerID] {
+					return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Player %d is listed more than once", playerID)}
+				}
+				seen[playerID] = true
+				if _, ok := byID[playerID]; !ok {
+					return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Player %d is not on team %d in match %d", playerID, sub.TeamID, matchID)}
+				}
+			}
+		}
+
+		for _, playerID := range sub.Out {
+			if statErr := validateNewStat(byID[playerID].Stats, "out"); statErr != nil {
+				return nil, &matchStatError{statErr.Status, fmt.Sprintf("Player %d: %s", playerID, statErr.Message)}
+			}
+		}
+		for _, playerID := range sub.In {
+			if statErr := validateNewStat(byID[playerID].Stats, "in"); statErr != nil {
+				return nil, &matchStatError{statErr.Status, fmt.Sprintf("Player %d: %s", playerID, statErr.Message)}
+			}
+		}
+
+		if after := countOnCourt(players) - len(sub.Out) + len(sub.In); after != playersOnCourt {
+			return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Substitution leaves team %d with %d players on court", sub.TeamID, after)}
+		}
+
+		var writes []statWrite
+		for _, group := range []struct {
+			stat      string
+			playerIDs []int
+		}{{"out", sub.Out}, {"in", sub.In}} {
+			for _, playerID := range group.playerIDs {
+				record, err := newStatRecord(tx, matchID, sub.Minute, period, group.stat)
+				if err != nil {
+					return nil, &matchStatError{http.StatusInternalServerError, "Failed to save substitution to Redis"}
+				}
+				writes = append(writes, statWrite{sub.TeamID, playerID, byID[playerID].RedisKey, record})
+			}
+		}
+		return writes, nil
+	})
+	if statErr != nil {
+		http.Error(w, statErr.Message, statErr.Status)
+		return
+	}
+
+	if err := advanceMatchPeriod(matchID, period); err != nil {
+		log.Printf("Failed to advance match %d to %s: %v", matchID, periodLabel(period), err)
+	}
+
+	var events []MatchEvent
+	for _, sw := range writes {
+		events = append(events, announceMatchEvent(sw.event(matchID, "")))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// substituteFor picks the bench player coming in for a player who just fouled out or was
+// ejected: the eligible player with the fewest fouls, lowest player id first. It returns
+// the "in" record to append along with the disqualified player's "out", or nil when the
+// team still has five on court or nobody is eligible, in which case it plays on with four.
+func substituteFor(rdb redis.Cmdable, matchID, teamID, playerID int, minute string, period int) (*statWrite, error) {
+	players, err := liveTeamPlayers(rdb, matchID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the disqualified player is still on court until their "out" is appended
+	onCourt := countOnCourt(players)
+	for _, p := range players {
+		if p.PlayerID == playerID && p.onCourt() {
+			onCourt--
+		}
+	}
+	if onCourt >= playersOnCourt {
+		return nil, nil
+	}
+
+	var replacement *livePlayer
+	replacementFouls := 0
+	for i, p := range players {
+		if p.PlayerID == playerID || p.onCourt() || p.disqualified() {
+			continue
+		}
+		fouls := countPersonalFouls(p.Stats)
+		if replacement == nil || fouls < replacementFouls {
+			replacement = &players[i]
+			replacementFouls = fouls
+		}
+	}
+
+	if replacement == nil {
+		log.Printf("No eligible substitute for team %d in match %d, playing with %d", teamID, matchID, onCourt)
+		return nil, nil
+	}
+
+	record, err := newStatRecord(rdb, matchID, minute, period, "in")
+	if err != nil {
+		return nil, err
+	}
+
+	return &statWrite{teamID, replacement.PlayerID, replacement.RedisKey, record}, nil
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"skyhawk/db"
+	"time"
+)
+
+// matchSyncResult is the outcome of storing a final live match in Postgres
+type matchSyncResult struct {
+	MatchID   int    `json:"matchId"`
+	Status    string `json:"status"`
+	Events    int    `json:"events"` // stat events stored
+	HomeScore int    `json:"homeScore"`
+	AwayScore int    `json:"awayScore"`
+}
+
+// syncMatch stores a final live match in Postgres: its stat events, roster, team fouls and score,
+// along with the synced status, in a single transaction. It is safe to re-run: the events replace
+// any stored by an earlier attempt, and a match already synced is left as it is.
+// The live match is cleared from Redis only once the transaction has committed.
+func syncMatch(matchID int) (matchSyncResult, error) {
+	result := matchSyncResult{MatchID: matchID}
+
+	tx, err := db.PG.Begin()
+	if err != nil {
+		return result, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the match makes a concurrent sync of it wait for this one, and then find it synced
+	var matchDate time.Time
+	var homeTeamID, awayTeamID int
+	err = tx.QueryRow(`
+		SELECT date, home_team, away_team, home_score, away_score, status FROM matches WHERE match_id = $1 FOR UPDATE
+	`, matchID).Scan(&matchDate, &homeTeamID, &awayTeamID, &result.HomeScore, &result.AwayScore, &result.Status)
+	if err != nil {
+		return result, fmt.Errorf("failed to read match: %v", err)
+	}
+
+	if result.Status == matchSynced {
+		// an earlier sync committed, only its Redis cleanup may be left
+		if isLiveMatch(matchID) {
+			clearLiveMatch(matchID, nil)
+		}
+		return result, nil
+	}
+	if result.Status != matchFinal {
+		return result, fmt.Errorf("match %d is %s, only a final match is synced", matchID, result.Status)
+	}
+
+	// the events of the match, read through the syncer group with the streams live store
+	var records []matchRecord
+	var streamIDs []string
+	if matchStreamStore(matchID) {
+		records, streamIDs, err = syncerMatchRecords(matchID)
+	} else {
+		records, err = liveMatchRecords(matchID)
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to fetch stats: %v", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM matches_stats WHERE match_id = $1`, matchID); err != nil {
+		return result, fmt.Errorf("failed to clear earlier attempt: %v", err)
+	}
+
+	points := make(map[int]int)
+	for _, record := range records {
+		// team stats have no player, and only linked plays have the other side
+		var playerID, eventID, linkedPlayerID, linkedEventID any
+		if record.PlayerID != 0 {
+			playerID = record.PlayerID
+		}
+		if record.EventID != "" {
+			eventID = record.EventID
+		}
+		if record.LinkedPlayerID != 0 {
+			linkedPlayerID = record.LinkedPlayerID
+			linkedEventID = record.LinkedEventID
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO matches_stats (match_id, team_id, player_id, minute, period, stat, match_date, event_id, linked_player_id, linked_event_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`, matchID, record.TeamID, playerID, record.Minute, record.Period, record.Stat, matchDate, eventID, linkedPlayerID, linkedEventID)
+		if err != nil {
+			return result, fmt.Errorf("failed to insert event %s: %v", record.EventID, err)
+		}
+
+		points[record.TeamID] += pointValues[record.Stat]
+	}
+
+	if err := syncMatchRoster(tx, matchID); err != nil {
+		return result, fmt.Errorf("failed to insert roster: %v", err)
+	}
+
+	if err := syncTeamFouls(tx, matchID); err != nil {
+		return result, fmt.Errorf("failed to insert team fouls: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE matches
+		SET home_score = $1, away_score = $2, status = $3
+		WHERE match_id = $4
+	`, points[homeTeamID], points[awayTeamID], matchSynced, matchID)
+	if err != nil {
+		return result, fmt.Errorf("failed to update match: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("failed to commit: %v", err)
+	}
+
+	result.Status = matchSynced
+	result.Events = len(records)
+	result.HomeScore = points[homeTeamID]
+	result.AwayScore = points[awayTeamID]
+
+	clearLiveMatch(matchID, streamIDs)
+
+	return result, nil
+}
+
+// clearLiveMatch removes a synced match from Redis. Failures are logged only, the match is
+// already stored and a later sync finishes the cleanup.
+func clearLiveMatch(matchID int, streamIDs []string) {
+	keys, err := matchRedisKeys(matchID)
+	if err != nil {
+		log.Printf("Failed to list Redis keys of match %d: %v", matchID, err)
+		return
+	}
+
+	if err := db.Redis.SRem(db.Ctx, activeMatchesKey, matchID).Err(); err != nil {
+		log.Printf("Failed to remove match %d from active matches: %v", matchID, err)
+	}
+
+	if err := db.Redis.Del(db.Ctx, keys...).Err(); err != nil {
+		log.Printf("Failed to delete Redis keys for match %d: %v", matchID, err)
+	} else {
+		log.Printf("Successfully deleted Redis keys for match %d", matchID)
+	}
+
+	if err := completeMatchStream(matchID, streamIDs); err != nil {
+		log.Printf("Failed to acknowledge the stream of match %d: %v", matchID, err)
+	}
+}
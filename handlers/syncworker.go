@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+)
+
+// Sync jobs.
+// A match whose sync fails when it ends is queued in sync:queue, a sorted set of match ids scored
+// by the time of their next attempt, and retried by the sync worker with exponential backoff.
+// Each job's state is kept in the sync:job:{matchId} hash, and sync:jobs lists every job.
+// A worker takes a due job by pushing its score a lease ahead, so if the worker dies mid-sync
+// the job becomes due again once the lease runs out.
+const (
+	syncQueueKey = "sync:queue"
+	syncJobsKey  = "sync:jobs"
+
+	syncWorkerInterval = time.Second
+	syncJobLease       = 2 * time.Minute
+	syncBackoffBase    = 5 * time.Second
+	syncBackoffMax     = 10 * time.Minute
+	maxSyncAttempts    = 10
+	// how long a synced job stays listed
+	syncedJobTTL = 24 * time.Hour
+)
+
+const (
+	syncJobQueued  = "queued"
+	syncJobSyncing = "syncing"
+	syncJobFailed  = "failed" // gave up after maxSyncAttempts, until retried by hand
+	syncJobSynced  = "synced"
+)
+
+// errSyncNotQueued is joined to a failed sync whose retry could not be queued either
+var errSyncNotQueued = errors.New("its retry could not be queued")
+
+func syncJobKey(matchID int) string {
+	return fmt.Sprintf("sync:job:%d", matchID)
+}
+
+// syncBackoff returns the wait before the next attempt, after the given number of failed ones
+func syncBackoff(attempts int) time.Duration {
+	backoff := syncBackoffBase
+	for i := 1; i < attempts && backoff < syncBackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, syncBackoffMax)
+}
+
+// queueMatchSync queues the sync of a match after a failed attempt
+func queueMatchSync(matchID int, syncErr error) error {
+	attempts, err := db.Redis.HIncrBy(db.Ctx, syncJobKey(matchID), "attempts", 1).Result()
+	if err != nil {
+		return err
+	}
+	return scheduleSyncJob(matchID, int(attempts), syncErr)
+}
+
+// scheduleSyncJob records a failed attempt and schedules the next one, or gives up
+func scheduleSyncJob(matchID, attempts int, syncErr error) error {
+	now := time.Now()
+	job := map[string]interface{}{
+		"last_error":      syncErr.Error(),
+		"last_attempt_at": now.Format(time.RFC3339),
+	}
+
+	_, err := db.Redis.TxPipelined(db.Ctx, func(pipe redis.Pipeliner) error {
+		if attempts >= maxSyncAttempts {
+			job["status"] = syncJobFailed
+			job["next_attempt_at"] = ""
+			pipe.ZRem(db.Ctx, syncQueueKey, matchID)
+		} else {
+			next := now.Add(syncBackoff(attempts))
+			job["status"] = syncJobQueued
+			job["next_attempt_at"] = next.Format(time.RFC3339)
+			pipe.ZAdd(db.Ctx, syncQueueKey, redis.Z{Score: float64(next.UnixMilli()), Member: matchID})
+		}
+		pipe.HSet(db.Ctx, syncJobKey(matchID), job)
+		pipe.Persist(db.Ctx, syncJobKey(matchID))
+		pipe.SAdd(db.Ctx, syncJobsKey, matchID)
+		return nil
+	})
+	return err
+}
+
+// completeSyncJob marks the job of a synced match, if it had one, as done
+func completeSyncJob(matchID int) {
+	exists, err := db.Redis.Exists(db.Ctx, syncJobKey(matchID)).Result()
+	if err != nil || exists == 0 {
+		return
+	}
+
+	_, err = db.Redis.TxPipelined(db.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(db.Ctx, syncQueueKey, matchID)
+		pipe.HSet(db.Ctx, syncJobKey(matchID), "status", syncJobSynced, "next_attempt_at", "", "last_error", "")
+		pipe.Expire(db.Ctx, syncJobKey(matchID), syncedJobTTL)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to complete sync job of match %d: %v", matchID, err)
+	}
+}
+
+// runMatchSync syncs a match, and queues a retry when it fails.
+// When the retry can't be queued either, the error also wraps errSyncNotQueued.
+func runMatchSync(matchID int) (matchSyncResult, error) {
+	result, err := syncMatch(matchID)
+	if err != nil {
+		if queueErr := queueMatchSync(matchID, err); queueErr != nil {
+			log.Printf("Failed to queue sync of match %d: %v", matchID, queueErr)
+			return result, fmt.Errorf("%w, %w", err, errSyncNotQueued)
+		}
+		return result, err
+	}
+
+	completeSyncJob(matchID)
+	return result, nil
+}
+
+// claimSyncJob takes the next due job, if any, leasing it to this worker
+func claimSyncJob() (int, bool, error) {
+	var matchID int
+	claimed := false
+
+	err := db.Redis.Watch(db.Ctx, func(tx *redis.Tx) error {
+		due, err := tx.ZRangeByScore(db.Ctx, syncQueueKey, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+			Count: 1,
+		}).Result()
+		if err != nil || len(due) == 0 {
+			return err
+		}
+
+		matchID, err = strconv.Atoi(due[0])
+		if err != nil {
+			return tx.ZRem(db.Ctx, syncQueueKey, due[0]).Err()
+		}
+
+		_, err = tx.TxPipelined(db.Ctx, func(pipe redis.Pipeliner) error {
+			lease := time.Now().Add(syncJobLease)
+			pipe.ZAdd(db.Ctx, syncQueueKey, redis.Z{Score: float64(lease.UnixMilli()), Member: matchID})
+			pipe.HSet(db.Ctx, syncJobKey(matchID), "status", syncJobSyncing)
+			return nil
+		})
+		claimed = err == nil
+		return err
+	}, syncQueueKey)
+
+	if errors.Is(err, redis.TxFailedErr) {
+		// another worker took it
+		return 0, false, nil
+	}
+	return matchID, claimed, err
+}
+
+// StartSyncWorker starts retrying the queued syncs of ended matches.
+// Any number of instances can run one, each job is leased to one worker at a time.
+func StartSyncWorker() {
+	go func() {
+		for {
+			matchID, claimed, err := claimSyncJob()
+			if err != nil {
+				log.Printf("[Sync worker] Failed to read the sync queue: %v", err)
+			}
+			if !claimed {
+				time.Sleep(syncWorkerInterval)
+				continue
+			}
+
+			if _, err := runMatchSync(matchID); err != nil {
+				log.Printf("[Sync worker] Sync of match %d failed: %v", matchID, err)
+			} else {
+				log.Printf("[Sync worker] Match %d synced", matchID)
+			}
+		}
+	}()
+}
+
+// syncJob is the state of a match's sync, as listed by the admin API
+type syncJob struct {
+	MatchID       int    `json:"matchId"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"lastError,omitempty"`
+	LastAttemptAt string `json:"lastAttemptAt,omitempty"`
+	NextAttemptAt string `json:"nextAttemptAt,omitempty"`
+}
+
+func loadSyncJob(matchID int) (*syncJob, error) {
+	fields, err := db.Redis.HGetAll(db.Ctx, syncJobKey(matchID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	attempts, _ := strconv.Atoi(fields["attempts"])
+	return &syncJob{
+		MatchID:       matchID,
+		Status:        fields["status"],
+		Attempts:      attempts,
+		LastError:     fields["last_error"],
+		LastAttemptAt: fields["last_attempt_at"],
+		NextAttemptAt: fields["next_attempt_at"],
+	}, nil
+}
+
+// writeQueuedSyncJob answers a sync that failed, syncErr from runMatchSync, with 202 and the job
+// retrying it. It answers 500 when no retry is queued: queueing failed too, the job can't be read
+// back, or the job gave up after maxSyncAttempts.
+func writeQueuedSyncJob(w http.ResponseWriter, matchID int, syncErr error) {
+	if errors.Is(syncErr, errSyncNotQueued) {
+		http.Error(w, fmt.Sprintf("Sync of match %d failed and its retry could not be queued", matchID), http.StatusInternalServerError)
+		return
+	}
+
+	job, err := loadSyncJob(matchID)
+	if err != nil || job == nil {
+		log.Printf("Failed to read sync job of match %d: %v", matchID, err)
+		http.Error(w, fmt.Sprintf("Sync of match %d failed and its retry could not be confirmed", matchID), http.StatusInternalServerError)
+		return
+	}
+	if job.Status != syncJobQueued {
+		http.Error(w, fmt.Sprintf("Sync of match %d failed after %d attempts, retry it with /api/admin/sync-jobs/%d/retry", matchID, job.Attempts, matchID), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetSyncJobs lists the sync jobs of ended matches, ?status= to filter
+func GetSyncJobs(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+
+	members, err := db.Redis.SMembers(db.Ctx, syncJobsKey).Result()
+	if err != nil {
+		http.Error(w, "Failed to read sync jobs", http.StatusInternalServerError)
+		return
+	}
+
+	jobs := []syncJob{}
+	for _, member := range members {
+		matchID, err := strconv.Atoi(member)
+		if err != nil {
+			continue
+		}
+
+		job, err := loadSyncJob(matchID)
+		if err != nil {
+			http.Error(w, "Failed to read sync jobs", http.StatusInternalServerError)
+			return
+		}
+		if job == nil {
+			// a synced job that expired
+			db.Redis.SRem(db.Ctx, syncJobsKey, member)
+			continue
+		}
+
+		if status == "" || job.Status == status {
+			jobs = append(jobs, *job)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].MatchID < jobs[j].MatchID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// RetrySyncJob syncs an ended match right away, whatever its backoff. A failure counts as a
+// fresh attempt, so a job that gave up is retried with the full backoff again.
+func RetrySyncJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	matchID, err := strconv.Atoi(vars["matchId"])
+	if err != nil {
+		http.Error(w, "Invalid matchId format", http.StatusBadRequest)
+		return
+	}
+
+	status, err := matchStatus(matchID)
+	if err != nil {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+	if status != matchFinal {
+		http.Error(w, fmt.Sprintf("Match %d is %s, only a final match is synced", matchID, status), http.StatusConflict)
+		return
+	}
+
+	if err := db.Redis.HSet(db.Ctx, syncJobKey(matchID), "attempts", 0).Err(); err != nil {
+		http.Error(w, "Failed to reset sync job", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := runMatchSync(matchID)
+	if err != nil {
+		writeQueuedSyncJob(w, matchID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"skyhawk/db"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestSyncBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1:  syncBackoffBase,
+		2:  2 * syncBackoffBase,
+		4:  8 * syncBackoffBase,
+		20: syncBackoffMax,
+	} {
+		if got := syncBackoff(attempts); got != want {
+			t.Errorf("backoff after %d attempts is %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestSyncJobLeasedToOneWorker(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+
+	if err := queueMatchSync(testMatchID, errors.New("connection refused")); err != nil {
+		t.Fatalf("failed to queue sync: %v", err)
+	}
+	if _, claimed, _ := claimSyncJob(); claimed {
+		t.Fatalf("claimed a job before its backoff ran out")
+	}
+
+	// make it due
+	db.Redis.ZAdd(db.Ctx, syncQueueKey, redis.Z{Score: 0, Member: testMatchID})
+	matchID, claimed, err := claimSyncJob()
+	if err != nil || !claimed || matchID != testMatchID {
+		t.Fatalf("claimed match %d (%v, %v), want %d", matchID, claimed, err, testMatchID)
+	}
+	if _, claimed, _ := claimSyncJob(); claimed {
+		t.Errorf("claimed a job already leased to another worker")
+	}
+
+	job, _ := loadSyncJob(testMatchID)
+	if job == nil || job.Status != syncJobSyncing || job.Attempts != 1 || job.LastError != "connection refused" {
+		t.Errorf("unexpected job state %+v", job)
+	}
+}
+
+func TestSyncJobGivesUp(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+
+	for i := 0; i < maxSyncAttempts; i++ {
+		if err := queueMatchSync(testMatchID, errors.New("timeout")); err != nil {
+			t.Fatalf("failed to queue sync: %v", err)
+		}
+	}
+
+	job, _ := loadSyncJob(testMatchID)
+	if job == nil || job.Status != syncJobFailed || job.Attempts != maxSyncAttempts {
+		t.Errorf("unexpected job state %+v", job)
+	}
+	if queued := db.Redis.ZCard(db.Ctx, syncQueueKey).Val(); queued != 0 {
+		t.Errorf("%d jobs still queued after giving up", queued)
+	}
+}
+
+func TestQueuedSyncJobResponse(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+
+	syncErr := errors.New("connection refused")
+
+	// queueing failed too, nothing to point the client at
+	rec := httptest.NewRecorder()
+	writeQueuedSyncJob(rec, testMatchID, syncErr)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d without a job, want 500", rec.Code)
+	}
+
+	if err := queueMatchSync(testMatchID, syncErr); err != nil {
+		t.Fatalf("failed to queue sync: %v", err)
+	}
+
+	// the job exists from an earlier attempt, but this one wasn't queued
+	rec = httptest.NewRecorder()
+	writeQueuedSyncJob(rec, testMatchID, fmt.Errorf("%w, %w", syncErr, errSyncNotQueued))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d when queueing the retry failed, want 500", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	writeQueuedSyncJob(rec, testMatchID, syncErr)
+	var job syncJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); rec.Code != http.StatusAccepted || err != nil || job.MatchID != testMatchID || job.Status != syncJobQueued {
+		t.Errorf("status %d with job %+v, want 202 with the queued job", rec.Code, job)
+	}
+}
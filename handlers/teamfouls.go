@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"skyhawk/db"
+	"slices"
+)
+
+// Team fouls are the personal fouls of all of a team's players, counted per period.
+// Once a team has committed teamFoulPenalty(period) fouls in a period it is in the penalty:
+// every further defensive foul sends the opponent, who is then in the bonus, to the line.
+const (
+	quarterTeamFoulPenalty  = 4
+	overtimeTeamFoulPenalty = 3
+)
+
+var teamFoulStats = []string{"team_fouls", "team_fouls_by_period", "penalty", "bonus"}
+
+func teamFoulPenalty(period int) int {
+	if period <= regulationPeriods {
+		return quarterTeamFoulPenalty
+	}
+	return overtimeTeamFoulPenalty
+}
+
+// teamFoulsByPeriod counts the fouls of a team in a live match per period
+func teamFoulsByPeriod(matchID, teamID int) (map[int]int, error) {
+	players, err := liveTeamPlayers(db.Redis, matchID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	fouls := make(map[int]int)
+	for _, p := range players {
+		for _, item := range p.Stats {
+			var record map[string]string
+			if err := json.Unmarshal([]byte(item), &record); err != nil {
+				continue
+			}
+			if slices.Contains(personalFoulStats, record["stat"]) {
+				fouls[periodOfRecord(record)]++
+			}
+		}
+	}
+	return fouls, nil
+}
+
+// teamFoulSummary returns the team foul stats of a team for the current period of a live match
+func teamFoulSummary(matchID, teamID int) (map[string]interface{}, error) {
+	period := currentMatchPeriod(matchID)
+
+	fouls, err := teamFoulsByPeriod(matchID, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	homeTeamID, awayTeamID := matchTeams(matchID)
+	opponentID := homeTeamID
+	if teamID == homeTeamID {
+		opponentID = awayTeamID
+	}
+	opponentFouls, err := teamFoulsByPeriod(matchID, opponentID)
+	if err != nil {
+		return nil, err
+	}
+
+	byPeriod := make(map[string]int)
+	for p := 1; p <= period; p++ {
+		byPeriod[periodLabel(p)] = fouls[p]
+	}
+
+	return map[string]interface{}{
+		"team_fouls":           fouls[period],
+		"team_fouls_by_period": byPeriod,
+		"penalty":              fouls[period] >= teamFoulPenalty(period),
+		"bonus":                opponentFouls[period] >= teamFoulPenalty(period),
+	}, nil
+}
+
+// syncTeamFouls saves the team fouls per period of a finished match to 'matches_team_fouls'
+func syncTeamFouls(tx *sql.Tx, matchID int) error {
+	homeTeamID, awayTeamID := matchTeams(matchID)
+	lastPeriod := currentMatchPeriod(matchID)
+
+	for _, teamID := range []int{homeTeamID, awayTeamID} {
+		fouls, err := teamFoulsByPeriod(matchID, teamID)
+		if err != nil {
+			return err
+		}
+
+		for period := 1; period <= lastPeriod; period++ {
+			_, err := tx.Exec(`
+				INSERT INTO matches_team_fouls (match_id, team_id, period, fouls, penalty_reached)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (match_id, team_id, period) DO UPDATE
+				SET fouls = EXCLUDED.fouls, penalty_reached = EXCLUDED.penalty_reached
+			`, matchID, teamID, period, fouls[period], fouls[period] >= teamFoulPenalty(period))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
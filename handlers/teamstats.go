@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"slices"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Team-level live stats are not credited to any player. They are kept in a list per team,
+// match:{matchId}:team:{teamId}:stats, next to the players' lists.
+var validTeamStatsToAdd = []string{"bench_technical_fouls", "coach_technical_fouls", "full_timeouts", "short_timeouts"}
+
+// The head coach is ejected on their second technical
+const coachTechnicalLimit = 2
+
+func teamStatsKey(matchID, teamID int) string {
+	return fmt.Sprintf("match:%d:team:%d:stats", matchID, teamID)
+}
+
+func validateNewTeamStat(stats []string, stat string, period int) *matchStatError {
+	if stat == "coach_technical_fouls" && countStat(stats, stat) >= coachTechnicalLimit {
+		return &matchStatError{http.StatusForbidden, fmt.Sprintf("Coach was ejected for %d technical fouls, ignoring this stat", coachTechnicalLimit)}
+	}
+	if _, ok := timeoutAllowances[stat]; ok {
+		return validateNewTimeout(stats, stat, period)
+	}
+	return nil
+}
+
+// validateTeamStatSequence checks a team's full stat list against the team-level rules
+func validateTeamStatSequence(stats []string) error {
+	if countStat(stats, "coach_technical_fouls") > coachTechnicalLimit {
+		return fmt.Errorf("coach can't get more than %d technical fouls", coachTechnicalLimit)
+	}
+	return validateTimeoutSequence(stats)
+}
+
+// recordTeamStat validates and records a team-level stat in a live match
+func recordTeamStat(MatchStat MatchStatInput, period int, source string) ([]MatchEvent, *matchStatError) {
+	if MatchStat.PlayerID != 0 {
+		return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("%s is a team stat, send teamId instead of playerId", MatchStat.Stat)}
+	}
+
+	if MatchStat.AssistPlayerID != 0 || MatchStat.BlockPlayerID != 0 || MatchStat.StealPlayerID != 0 {
+		return nil, &matchStatError{http.StatusBadRequest, "A team stat can't be linked to a player"}
+	}
+
+	homeTeamID, awayTeamID := matchTeams(MatchStat.MatchID)
+	if !isLiveMatch(MatchStat.MatchID) || !slices.Contains([]int{homeTeamID, awayTeamID}, MatchStat.TeamID) {
+		return nil, &matchStatError{http.StatusBadRequest, fmt.Sprintf("Team %d is not playing a live match %d", MatchStat.TeamID, MatchStat.MatchID)}
+	}
+
+	// only the team's own list decides whether the stat is accepted
+	redisKey := teamStatsKey(MatchStat.MatchID, MatchStat.TeamID)
+	writes, statErr := runStatTx(MatchStat.MatchID, source, []string{redisKey}, func(tx *redis.Tx) ([]statWrite, *matchStatError) {
+		stats, err := tx.LRange(db.Ctx, redisKey, 0, -1).Result()
+		if err != nil {
+			return nil, &matchStatError{http.StatusInternalServerError, "Failed to read team stats from Redis"}
+		}
+
+		if statErr := validateNewTeamStat(stats, MatchStat.Stat, period); statErr != nil {
+			return nil, statErr
+		}
+
+		record, err := newStatRecord(tx, MatchStat.MatchID, MatchStat.Minute, period, MatchStat.Stat)
+		if err != nil {
+			return nil, &matchStatError{http.StatusInternalServerError, "Failed to save stat to Redis"}
+		}
+		return []statWrite{{MatchStat.TeamID, 0, redisKey, record}}, nil
+	})
+	if statErr != nil {
+		return nil, statErr
+	}
+
+	if err := advanceMatchPeriod(MatchStat.MatchID, period); err != nil {
+		log.Printf("Failed to advance match %d to %s: %v", MatchStat.MatchID, periodLabel(period), err)
+	}
+
+	return []MatchEvent{announceMatchEvent(writes[0].event(MatchStat.MatchID, source))}, nil
+}
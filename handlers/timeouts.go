@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"skyhawk/db"
+)
+
+// Timeouts are team stats. Each team gets a number of full and short timeouts per half,
+// and a fresh allowance in every overtime. Unused timeouts don't carry over.
+var timeoutAllowances = map[string]struct {
+	firstHalf  int
+	secondHalf int
+	overtime   int
+}{
+	"full_timeouts":  {2, 3, 1},
+	"short_timeouts": {1, 1, 0},
+}
+
+var timeoutStats = []string{"timeouts_remaining"}
+
+// timeoutWindow returns the label of the stretch of the match whose timeout allowance a
+// period uses: "H1", "H2", or the overtime itself
+func timeoutWindow(period int) string {
+	switch {
+	case period <= regulationPeriods/2:
+		return "H1"
+	case period <= regulationPeriods:
+		return "H2"
+	default:
+		return periodLabel(period)
+	}
+}
+
+func timeoutAllowance(stat string, period int) int {
+	allowance := timeoutAllowances[stat]
+	switch timeoutWindow(period) {
+	case "H1":
+		return allowance.firstHalf
+	case "H2":
+		return allowance.secondHalf
+	default:
+		return allowance.overtime
+	}
+}
+
+// timeoutsTaken counts the timeouts of a type a team took in the window of a period
+func timeoutsTaken(stats []string, stat string, period int) int {
+	count := 0
+	for _, item := range stats {
+		var record map[string]string
+		if err := json.Unmarshal([]byte(item), &record); err != nil {
+			continue
+		}
+		if record["stat"] == stat && timeoutWindow(periodOfRecord(record)) == timeoutWindow(period) {
+			count++
+		}
+	}
+	return count
+}
+
+func validateNewTimeout(stats []string, stat string, period int) *matchStatError {
+	if timeoutsTaken(stats, stat, period) >= timeoutAllowance(stat, period) {
+		return &matchStatError{http.StatusForbidden, fmt.Sprintf("No %s left in %s, %d allowed", stat, timeoutWindow(period), timeoutAllowance(stat, period))}
+	}
+	return nil
+}
+
+// validateTimeoutSequence checks no window of a team's stat list is over its timeout allowance
+func validateTimeoutSequence(stats []string) error {
+	for _, item := range stats {
+		var record map[string]string
+		if err := json.Unmarshal([]byte(item), &record); err != nil {
+			continue
+		}
+		stat := record["stat"]
+		if _, ok := timeoutAllowances[stat]; !ok {
+			continue
+		}
+		period := periodOfRecord(record)
+		if timeoutsTaken(stats, stat, period) > timeoutAllowance(stat, period) {
+			return fmt.Errorf("more than %d %s in %s", timeoutAllowance(stat, period), stat, timeoutWindow(period))
+		}
+	}
+	return nil
+}
+
+// timeoutsRemaining returns how many timeouts of each type a team has left in the
+// current window of a live match
+func timeoutsRemaining(matchID, teamID int) (map[string]int, error) {
+	stats, err := db.Redis.LRange(db.Ctx, teamStatsKey(matchID, teamID), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read team stats from Redis")
+	}
+
+	period := currentMatchPeriod(matchID)
+	remaining := make(map[string]int)
+	for stat := range timeoutAllowances {
+		remaining[stat] = timeoutAllowance(stat, period) - timeoutsTaken(stats, stat, period)
+	}
+	return remaining, nil
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"skyhawk/db"
+	"slices"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Stat submissions validate against the live lists and then append to them. To keep two
+// scorekeepers from both passing the same check (a double "in", a seventh foul), the read,
+// the validation and the append run as one optimistic transaction: the lists of the match
+// are WATCHed, and the writes go through MULTI/EXEC only if none of them changed meanwhile.
+// Otherwise the submission is validated again against the new state.
+const maxStatTxAttempts = 10
+
+// statWrite is a record to append to a live stats list
+type statWrite struct {
+	TeamID   int
+	PlayerID int // 0 for a team stat
+	RedisKey string
+	Record   map[string]string
+}
+
+// event returns the stream event of an appended record
+func (sw statWrite) event(matchID int, source string) MatchEvent {
+	return MatchEvent{
+		Type:           "stat",
+		MatchID:        matchID,
+		EventID:        sw.Record["id"],
+		TeamID:         sw.TeamID,
+		PlayerID:       sw.PlayerID,
+		Minute:         sw.Record["minute"],
+		Period:         periodOfRecord(sw.Record),
+		Stat:           sw.Record["stat"],
+		LinkedPlayerID: linkedPlayerOf(sw.Record),
+		LinkedEventID:  sw.Record["linked_event_id"],
+		Source:         source,
+	}
+}
+
+// runMatchTx runs prepare, which reads and validates the live lists through tx and returns the
+// writes to make, and makes them atomically, retrying while the watched keys are being written
+// concurrently. failure is the message of the error returned when Redis fails.
+// With the streams live store the lists are the projection of the match stream: it is caught
+// up before prepare reads it, the stream is watched instead, as the writes append to it, and
+// the appended entries are projected once written.
+func runMatchTx(matchID int, keys []string, failure string, prepare func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, *matchStatError)) *matchStatError {
+	streamed := matchStreamStore(matchID)
+	if streamed {
+		keys = append(slices.Clone(keys), matchStreamKey(matchID), matchProjectedKey(matchID))
+	}
+
+	for attempt := 0; attempt < maxStatTxAttempts; attempt++ {
+		var statErr *matchStatError
+
+		if streamed {
+			if err := projectMatchStream(matchID); err != nil {
+				log.Printf("%v", err)
+				return &matchStatError{http.StatusInternalServerError, failure}
+			}
+		}
+
+		err := db.Redis.Watch(db.Ctx, func(tx *redis.Tx) error {
+			if streamed {
+				// appended to since it was caught up, caught up again on the next attempt
+				behind, err := projectionBehind(tx, matchID)
+				if err != nil {
+					return err
+				}
+				if behind {
+					return redis.TxFailedErr
+				}
+			}
+
+			var write func(pipe redis.Pipeliner) error
+			write, statErr = prepare(tx)
+			if statErr != nil {
+				return statErr
+			}
+
+			_, err := tx.TxPipelined(db.Ctx, write)
+			return err
+		}, keys...)
+
+		if statErr != nil {
+			return statErr
+		}
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return &matchStatError{http.StatusInternalServerError, failure}
+		}
+
+		if streamed {
+			if err := projectMatchStream(matchID); err != nil {
+				log.Printf("%v", err)
+			}
+		}
+		return nil
+	}
+
+	return &matchStatError{http.StatusConflict, tooManyConcurrentUpdates}
+}
+
+// tooManyConcurrentUpdates is the conflict returned once runMatchTx gives up retrying
+const tooManyConcurrentUpdates = "Too many concurrent updates to the match, please retry"
+
+// runStatTx runs prepare, which reads and validates the live lists and returns the records
+// to append, and appends them atomically through runMatchTx. prepare must do its reads
+// through tx, on the watching connection.
+// With the streams live store the events of the records are appended to the match stream
+// instead, and projected to the lists from there.
+func runStatTx(matchID int, source string, keys []string, prepare func(tx *redis.Tx) ([]statWrite, *matchStatError)) ([]statWrite, *matchStatError) {
+	var writes []statWrite
+	streamed := matchStreamStore(matchID)
+
+	statErr := runMatchTx(matchID, keys, "Failed to save stat to Redis", func(tx *redis.Tx) (func(pipe redis.Pipeliner) error, *matchStatError) {
+		var statErr *matchStatError
+		writes, statErr = prepare(tx)
+		if statErr != nil {
+			return nil, statErr
+		}
+
+		// the stream events carry the score after each of them, as it will be once appended
+		var score MatchEvent
+		if streamed {
+			score = scoreMatchEvent(tx, MatchEvent{MatchID: matchID})
+		}
+
+		return func(pipe redis.Pipeliner) error {
+			for _, sw := range writes {
+				statJSON, err := json.Marshal(sw.Record)
+				if err != nil {
+					return err
+				}
+				if streamed {
+					score = score.addPoints(sw.TeamID, pointValues[sw.Record["stat"]])
+					if err := addStreamEvent(pipe, sw.event(matchID, source).withScore(score), string(statJSON)); err != nil {
+						return err
+					}
+					continue
+				}
+				pipe.RPush(db.Ctx, sw.RedisKey, statJSON)
+				pipe.HSet(db.Ctx, statIndexKey(matchID), sw.Record["id"], sw.RedisKey)
+			}
+			return nil
+		}, nil
+	})
+	if statErr != nil {
+		return nil, statErr
+	}
+	return writes, nil
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"skyhawk/db"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	testMatchID  = 1
+	testHomeTeam = 10
+	testAwayTeam = 20
+)
+
+// startTestMatch starts a live match on an in-memory Redis with 8 players per team,
+// of which the first onCourt of each team are in, with the live store selected.
+func startTestMatch(t *testing.T, onCourt int) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	previous := db.Redis
+	db.Redis = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() {
+		db.Redis.Close()
+		db.Redis = previous
+	})
+
+	db.Redis.Set(db.Ctx, fmt.Sprintf("match:%d:started", testMatchID), "true", 0)
+	db.Redis.Set(db.Ctx, fmt.Sprintf("match:%d:home_team", testMatchID), testHomeTeam, 0)
+	db.Redis.Set(db.Ctx, fmt.Sprintf("match:%d:away_team", testMatchID), testAwayTeam, 0)
+	db.Redis.Set(db.Ctx, matchPeriodKey(testMatchID), 1, 0)
+	if streamStore() {
+		if err := startMatchStream(testMatchID); err != nil {
+			t.Fatalf("failed to create match stream: %v", err)
+		}
+	}
+
+	for _, teamID := range []int{testHomeTeam, testAwayTeam} {
+		for i := 1; i <= 8; i++ {
+			playerID := teamID*10 + i
+			db.Redis.Set(db.Ctx, fmt.Sprintf("match:%d:player:%d:team", testMatchID, playerID), teamID, 0)
+			db.Redis.SAdd(db.Ctx, matchRosterKey(testMatchID, teamID), playerID)
+			if i <= onCourt {
+				if _, _, err := pushStatRecord(testMatchID, playerStatsKey(testMatchID, teamID, playerID), "00.00", 1, "in"); err != nil {
+					t.Fatalf("failed to start player %d: %v", playerID, err)
+				}
+			}
+		}
+	}
+}
+
+// recordUntilSettled submits a stat like a client would, resubmitting with a short backoff
+// while the match is too busy to take it
+func recordUntilSettled(t *testing.T, input MatchStatInput) *matchStatError {
+	for attempt := 1; attempt <= 50; attempt++ {
+		_, statErr := recordMatchStat(input, "")
+		if statErr == nil || statErr.Message != tooManyConcurrentUpdates {
+			return statErr
+		}
+		time.Sleep(time.Duration(attempt) * time.Millisecond)
+	}
+	t.Fatalf("stat %s of player %d still conflicting after 50 attempts", input.Stat, input.PlayerID)
+	return nil
+}
+
+func TestConcurrentFoulsStopAtSix(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+	playerID := testHomeTeam*10 + 1
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statErr := recordUntilSettled(t, MatchStatInput{MatchID: testMatchID, PlayerID: playerID, Minute: "05.00", Stat: "fouls"})
+			if statErr == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if accepted != personalFoulLimit {
+		t.Errorf("accepted %d fouls, want %d", accepted, personalFoulLimit)
+	}
+
+	stats, _ := db.Redis.LRange(db.Ctx, playerStatsKey(testMatchID, testHomeTeam, playerID), 0, -1).Result()
+	if fouls := countStat(stats, "fouls"); fouls != personalFoulLimit {
+		t.Errorf("player has %d fouls recorded, want %d", fouls, personalFoulLimit)
+	}
+	if outs := countStat(stats, "out"); outs != 1 {
+		t.Errorf("player has %d outs recorded, want 1", outs)
+	}
+
+	players, _ := liveTeamPlayers(db.Redis, testMatchID, testHomeTeam)
+	if n := countOnCourt(players); n != playersOnCourt {
+		t.Errorf("team has %d players on court after the foul-out substitution, want %d", n, playersOnCourt)
+	}
+}
+
+func TestConcurrentInAcceptsOne(t *testing.T) {
+	// one player short, so exactly one "in" brings the team back to five
+	startTestMatch(t, playersOnCourt-1)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 3; i++ {
+		for playerID := testHomeTeam*10 + playersOnCourt; playerID <= testHomeTeam*10+8; playerID++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				statErr := recordUntilSettled(t, MatchStatInput{MatchID: testMatchID, PlayerID: playerID, Minute: "03.00", Stat: "in"})
+				if statErr == nil {
+					mu.Lock()
+					accepted++
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if accepted != 1 {
+		t.Errorf("accepted %d ins, want 1", accepted)
+	}
+
+	players, _ := liveTeamPlayers(db.Redis, testMatchID, testHomeTeam)
+	if n := countOnCourt(players); n != playersOnCourt {
+		t.Errorf("team has %d players on court, want %d", n, playersOnCourt)
+	}
+	for _, p := range players {
+		if err := validateStatSequence(p.Stats); err != nil {
+			t.Errorf("player %d has an invalid sequence: %v", p.PlayerID, err)
+		}
+	}
+}
+
+func TestConcurrentDeletesApplyOnce(t *testing.T) {
+	startTestMatch(t, playersOnCourt)
+	playerID := testHomeTeam*10 + 1
+	eventID, _, err := pushStatRecord(testMatchID, playerStatsKey(testMatchID, testHomeTeam, playerID), "04.00", 1, "fouls")
+	if err != nil {
+		t.Fatalf("failed to record foul: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	deleted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				req := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/", nil), map[string]string{
+					"matchId": fmt.Sprint(testMatchID),
+					"eventId": eventID,
+				})
+				rec := httptest.NewRecorder()
+				DeleteMatchEvent(rec, req)
+				if rec.Code == http.StatusConflict {
+					continue
+				}
+				if rec.Code == http.StatusOK {
+					mu.Lock()
+					deleted++
+					mu.Unlock()
+				}
+				return
+			}
+		}()
+	}
+	wg.Wait()
+
+	if deleted != 1 {
+		t.Errorf("event deleted %d times, want 1", deleted)
+	}
+
+	events, _ := db.Redis.LRange(db.Ctx, matchEventsKey(testMatchID), 0, -1).Result()
+	deletes := 0
+	for _, ev := range events {
+		if strings.Contains(ev, `"type":"delete"`) {
+			deletes++
+		}
+	}
+	if deletes != 1 {
+		t.Errorf("%d delete events published, want 1", deletes)
+	}
+}
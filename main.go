@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"skyhawk/db"
+	"skyhawk/handlers"
 	"skyhawk/routes"
 	"strconv"
 	"time"
@@ -16,21 +17,21 @@ func startRedisKeyLogger() {
 
 	go func() {
 		for range ticker.C {
-			// Fetch Redis keys that match the pattern "match:*"
-			keys, err := db.Redis.Keys(db.Ctx, "match:*").Result()
+			// Fetch the ids of the live matches from the active matches index
+			matchIDs, err := db.Redis.SMembers(db.Ctx, "matches:active").Result()
 
-			// Check for errors while fetching keys
+			// Check for errors while fetching the index
 			if err != nil {
-				log.Printf("[Redis Logger] Error fetching match keys: %v", err)
+				log.Printf("[Redis Logger] Error fetching active matches: %v", err)
 				continue
 			}
 
-			// If no keys found, log an appropriate message
-			if len(keys) == 0 {
-				log.Println("[Redis Logger] No active match keys found.")
+			// If no matches found, log an appropriate message
+			if len(matchIDs) == 0 {
+				log.Println("[Redis Logger] No active matches found.")
 			} else {
-				// Log the found keys
-				log.Printf("[Redis Logger] Active match keys: %v", keys)
+				// Log the found matches
+				log.Printf("[Redis Logger] Active matches: %v", matchIDs)
 			}
 		}
 	}()
@@ -40,27 +41,33 @@ func clearAllMatchStats() error {
 	db.PG.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s;", "matches_stats"))
 	db.PG.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s;", "matches"))
 
-	var cursor uint64
-	match := "match:*"
+	// live matches and their sync jobs
+	for _, match := range []string{"match:*", "sync:*"} {
+		var cursor uint64
 
-	for {
-		keys, nextCursor, err := db.Redis.Scan(db.Ctx, cursor, match, 100).Result()
-		if err != nil {
-			return fmt.Errorf("scan failed: %v", err)
-		}
+		for {
+			keys, nextCursor, err := db.Redis.Scan(db.Ctx, cursor, match, 100).Result()
+			if err != nil {
+				return fmt.Errorf("scan failed: %v", err)
+			}
 
-		if len(keys) > 0 {
-			if err := db.Redis.Del(db.Ctx, keys...).Err(); err != nil {
-				return fmt.Errorf("failed to delete keys: %v", err)
+			if len(keys) > 0 {
+				if err := db.Redis.Del(db.Ctx, keys...).Err(); err != nil {
+					return fmt.Errorf("failed to delete keys: %v", err)
+				}
 			}
-		}
 
-		cursor = nextCursor
-		if cursor == 0 {
-			break
+			cursor = nextCursor
+			if cursor == 0 {
+				break
+			}
 		}
 	}
 
+	if err := db.Redis.Del(db.Ctx, "matches:active", "matches:streamed", "reconciliation:last").Err(); err != nil {
+		return fmt.Errorf("failed to delete active matches index: %v", err)
+	}
+
 	return nil
 }
 
@@ -77,6 +84,7 @@ func main() {
 	redisAddr := os.Getenv("REDIS_ADDR")
 	redisPassword := os.Getenv("REDIS_PASSWORD")
 	redisDBStr := os.Getenv("REDIS_DB")
+	liveStore := os.Getenv("LIVE_STORE") // "lists" (default) or "streams"
 
 	if redisDBStr == "" {
 		redisDBStr = "0"
@@ -89,6 +97,13 @@ func main() {
 	db.InitPostgres(fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", dbUser, dbPassword, dbHost, dbPort, dbName))
 	db.InitRedis(redisAddr, redisPassword, redisDB)
 
+	if err := handlers.SetLiveStore(liveStore); err != nil {
+		log.Fatalf("Invalid LIVE_STORE value: %v", err)
+	}
+	handlers.StartFeedsRelay()
+	handlers.ReconcileLiveMatches()
+	handlers.StartSyncWorker()
+
 	// clearAllMatchStats()
 
 	r := routes.SetupRouter()
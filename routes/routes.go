@@ -24,7 +24,7 @@ func SetupRouter() *mux.Router {
 
 	r.HandleFunc("/api/team_active_players/{teamId}", handlers.GetTeamActivePlayers).Methods("GET") // Get team active players
 
-	r.HandleFunc("/api/matches", handlers.GetMatches).Methods("GET")  // Get team match history
+	r.HandleFunc("/api/matches", handlers.GetMatches).Methods("GET")  // Get team match history, ?status= to filter
 	r.HandleFunc("/api/matches", handlers.AddMatches).Methods("POST") // Add team match history
 
 	//******************************//
@@ -32,6 +32,8 @@ func SetupRouter() *mux.Router {
 	//******************************//
 	// taken from 'matches_stats' (it will be populated in the end of the live match stat system, once match is over)
 
+	r.HandleFunc("/api/season/{season}/team/{teamId}/assist_network", handlers.GetAssistNetwork).Methods("GET") // Who assisted whom
+	r.HandleFunc("/api/season/{season}/team/{teamId}/top_lineups", handlers.GetTopLineups).Methods("GET")       // Best five-man units, ?sort=&limit=&min_minutes=
 	r.HandleFunc("/api/season/{season}/{entity}/{entityId}/{stat}", handlers.GetAverageStat).Methods("GET")
 
 	// Live match routes - Using Redis for real time performance
@@ -42,5 +44,21 @@ func SetupRouter() *mux.Router {
 	r.HandleFunc("/api/start_match/{matchId}", handlers.StartMatch).Methods("POST")
 	r.HandleFunc("/api/end_match/{matchId}", handlers.EndMatch).Methods("POST")
 
+	r.HandleFunc("/api/matches/{matchId}/events/stream", handlers.StreamMatchEvents).Methods("GET")      // SSE feed of accepted live events
+	r.HandleFunc("/api/matches/{matchId}/scorekeeper", handlers.ScorekeeperChannel).Methods("GET")       // WebSocket for live stat entry
+	r.HandleFunc("/api/matches/{matchId}/boxscore", handlers.GetBoxScore).Methods("GET")                 // Player lines, team totals and line score
+	r.HandleFunc("/api/matches/{matchId}/play-by-play", handlers.GetPlayByPlay).Methods("GET")           // Time ordered events of both teams
+	r.HandleFunc("/api/matches/{matchId}/lineups", handlers.GetMatchLineups).Methods("GET")              // Five-man units and how they did, ?teamId= for one team
+	r.HandleFunc("/api/matches/{matchId}/roster", handlers.GetMatchRoster).Methods("GET")                // Registered players and who is on court
+	r.HandleFunc("/api/matches/{matchId}/status", handlers.UpdateMatchStatus).Methods("PATCH")           // Pause, resume or cancel a match
+	r.HandleFunc("/api/matches/{matchId}/substitutions", handlers.SubstitutePlayers).Methods("POST")     // Swap players on court atomically
+	r.HandleFunc("/api/matches/{matchId}/events/{eventId}", handlers.AmendMatchEvent).Methods("PATCH")   // Fix a mis-recorded live event
+	r.HandleFunc("/api/matches/{matchId}/events/{eventId}", handlers.DeleteMatchEvent).Methods("DELETE") // Undo a live event
+
+	// Admin routes
+	r.HandleFunc("/api/admin/sync-jobs", handlers.GetSyncJobs).Methods("GET")                   // Sync jobs of ended matches, ?status= to filter
+	r.HandleFunc("/api/admin/sync-jobs/{matchId}/retry", handlers.RetrySyncJob).Methods("POST") // Sync a final match now
+	r.HandleFunc("/api/admin/reconciliation", handlers.GetReconciliationReport).Methods("GET")  // Report of the startup reconciliation
+
 	return r
 }